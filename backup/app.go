@@ -0,0 +1,336 @@
+// Package backup copies the ReliefWeb video playlists and their YouTube
+// videos into a GitHub repository.
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// checkpointTimeout bounds the commit of an interrupted run.
+const checkpointTimeout = 30 * time.Second
+
+// App runs backups. It is built from a Config by NewApp, which does no
+// network access; everything remote happens in Run.
+type App struct {
+	Config    Config
+	Selection Selection
+
+	// YoutubeAPIKey is sent with every playlistItems request.
+	YoutubeAPIKey string
+	// S3AccessKey and S3SecretKey sign the requests to the S3 sinks.
+	S3AccessKey, S3SecretKey string
+
+	// HTTPClient is used for YouTube and ReliefWeb.
+	HTTPClient *http.Client
+	// NotifyClient sends the notifications, apart from HTTPClient so
+	// their secret URLs are never recorded in a cassette. Notifications
+	// are skipped when nil, as on a replay.
+	NotifyClient *http.Client
+	// YoutubeOAuthClient authorizes the playlist writes of
+	// RestorePlaylist with YouTube OAuth.
+	YoutubeOAuthClient *http.Client
+	// GitHubClient is used for the host of the backup repository, GitHub
+	// unless Config.Backend says otherwise, and must authenticate its
+	// requests.
+	GitHubClient *http.Client
+
+	// Metrics counts runs and API calls, LastRun describes the latest run.
+	Metrics *Metrics
+	LastRun *Summary
+
+	now        func() time.Time
+	cacheStats CacheStats
+
+	github  *github.Client
+	backend Backend
+	// head is the commit the run builds on, changes are the files it
+	// writes.
+	head    *Snapshot
+	changes []Change
+	// thumbnails maps the image urls archived by the run to their paths,
+	// thumbnailPaths are the images it added.
+	thumbnails     map[string]string
+	thumbnailPaths map[string]bool
+	// captions is the caption state of the run, captionsBase its content
+	// in the base. Once captionsCapped no more quota is spent on captions.
+	captions       *captionState
+	captionsBase   string
+	captionsCapped bool
+	// archivedCaptions are the "<playlist dir>/<video id>" of the
+	// tracks in the base.
+	archivedCaptions map[string]bool
+	// day is the UTC date of the run, the one its files record.
+	day string
+	// baseFeeds are the archived feeds of the base read by the run.
+	baseFeeds map[string][]Playlist
+	// feeds are the playlists of the feeds fetched by the run, backedUp
+	// the videos of the playlist files it wrote.
+	feeds    map[string][]Playlist
+	backedUp map[string][]Video
+	// issues are the issue changes to make once the run is committed.
+	issues *issueUpdates
+}
+
+// Selection limits a run to some categories or playlists. An empty set
+// means everything is selected.
+type Selection struct {
+	Categories map[string]bool
+	Playlists  map[string]bool
+}
+
+// ParseList splits a comma separated flag value into a set.
+func ParseList(value string) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
+
+func (s Selection) includesCategory(category string) bool {
+	return len(s.Categories) == 0 || s.Categories[category]
+}
+
+// includesPlaylist matches a playlist by id or by title.
+func (s Selection) includesPlaylist(p Playlist) bool {
+	return len(s.Playlists) == 0 || s.Playlists[p.Id] || s.Playlists[p.Title]
+}
+
+// NewApp returns an App for config. Nil clients default to
+// http.DefaultClient.
+func NewApp(config Config, httpClient, repoClient *http.Client) (*App, error) {
+	config.setDefaults()
+	for _, n := range config.Notifications {
+		if err := n.validate(); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range config.Sinks {
+		if err := s.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if config.IssueAfter > 0 && config.Backend != "github" {
+		return nil, fmt.Errorf("issues need the github backend, not %s", config.Backend)
+	}
+	if !validArchiveFormat(config.ArchiveFormat) {
+		return nil, fmt.Errorf("unknown archive format %q", config.ArchiveFormat)
+	}
+	if config.ArchiveRelease && config.Backend != "github" {
+		return nil, fmt.Errorf("releases need the github backend, not %s", config.Backend)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if repoClient == nil {
+		repoClient = http.DefaultClient
+	}
+	base, err := url.Parse(config.GitHubURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub url %q: %s", config.GitHubURL, err)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	uploads, err := url.Parse(config.GitHubUploadURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub upload url %q: %s", config.GitHubUploadURL, err)
+	}
+	if !strings.HasSuffix(uploads.Path, "/") {
+		uploads.Path += "/"
+	}
+	a := &App{Config: config, Metrics: NewMetrics(), now: time.Now}
+	a.HTTPClient = a.cache(a.instrument(httpClient))
+	a.GitHubClient = a.instrument(repoClient)
+	a.NotifyClient = a.instrument(&http.Client{})
+	a.github = github.NewClient(a.GitHubClient)
+	a.github.BaseURL = base
+	a.github.UploadURL = uploads
+	if a.backend, err = a.newBackend(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SetClock replaces the clock of the App, a replay runs at the time of
+// its recording.
+func (a *App) SetClock(now func() time.Time) {
+	a.now = now
+}
+
+// CacheStats returns the cache hits since the App was created.
+func (a *App) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:       atomic.LoadInt64(&a.cacheStats.Hits),
+		QuotaSaved: atomic.LoadInt64(&a.cacheStats.QuotaSaved),
+	}
+}
+
+// loadHead resolves the current commit of the backup branch, the new
+// commit is built on top of it.
+func (a *App) loadHead(ctx context.Context) error {
+	head, err := a.backend.Head(ctx)
+	if err != nil {
+		return err
+	}
+	a.head = head
+	a.changes = nil
+	a.thumbnails = map[string]string{}
+	a.thumbnailPaths = map[string]bool{}
+	a.captions, a.captionsBase, a.captionsCapped = nil, "", false
+	a.archivedCaptions = nil
+	a.feeds = map[string][]Playlist{}
+	a.baseFeeds = map[string][]Playlist{}
+	a.backedUp = map[string][]Video{}
+	a.issues = nil
+	return nil
+}
+
+// addToTree stages content at path for the commit of the run, replacing
+// a removal of path.
+func (a *App) addToTree(path, content string) {
+	for i, c := range a.changes {
+		if c.Path == path && c.Delete {
+			a.changes = append(a.changes[:i], a.changes[i+1:]...)
+			break
+		}
+	}
+	a.changes = append(a.changes, Change{Path: path, Content: []byte(content)})
+}
+
+// removeFromTree stages the removal of path, unless the run writes it.
+func (a *App) removeFromTree(path string) {
+	for _, c := range a.changes {
+		if c.Path == path {
+			return
+		}
+	}
+	a.changes = append(a.changes, Change{Path: path, Delete: true})
+}
+
+// RunCategories backs up only categories, ignoring a.Selection.
+func (a *App) RunCategories(ctx context.Context, categories []string) error {
+	selection := a.Selection
+	defer func() { a.Selection = selection }()
+	a.Selection = Selection{Categories: map[string]bool{}}
+	for _, c := range categories {
+		a.Selection.Categories[c] = true
+	}
+	return a.Run(ctx)
+}
+
+// Run backs up the selected categories and commits the result. When ctx is
+// cancelled part way the playlists fetched so far are still committed, so
+// an interrupted run is not wasted.
+func (a *App) Run(ctx context.Context) (err error) {
+	summary := &Summary{Start: a.now(), CommitResult: "empty"}
+	a.LastRun = summary
+	a.day = summary.Start.UTC().Format(dateFormat)
+	stats := a.CacheStats()
+	defer func() {
+		summary.End = a.now()
+		end := a.CacheStats()
+		summary.CacheHits = end.Hits - stats.Hits
+		summary.QuotaSaved = end.QuotaSaved - stats.QuotaSaved
+		if summary.CacheHits > 0 {
+			log.Printf("%d responses from the cache saved %d quota units\n", summary.CacheHits, summary.QuotaSaved)
+		}
+		if err != nil {
+			summary.Error = err.Error()
+		}
+		a.Metrics.observeRun(summary, err)
+		a.notify(summary)
+	}()
+
+	if err := a.loadHead(ctx); err != nil {
+		summary.CommitResult = "failed"
+		return err
+	}
+	for _, category := range a.Config.Categories {
+		if !a.Selection.includesCategory(category) {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		log.Printf("category %v\n", category)
+		cs := &CategorySummary{Name: category}
+		summary.Categories = append(summary.Categories, cs)
+		rwPlaylists, err := a.getRwPlaylists(ctx, category)
+		var playlists []Playlist
+		if err == nil {
+			// A broken feed must not replace the archived one.
+			playlists, err = preparePlaylists(category, rwPlaylists)
+		}
+		if err != nil {
+			log.Printf("failed to get %s playlists: %s\n", category, err)
+			cs.FeedError = err.Error()
+			continue
+		}
+		a.feeds[category] = playlists
+		// The feed is only refreshed on full category runs, a playlist
+		// selection touches just the matching playlist files.
+		if len(a.Selection.Playlists) == 0 {
+			path := fmt.Sprintf("%s/playlist.json", category)
+			a.addToTree(path, string(rwPlaylists))
+		}
+
+		a.backupPlaylists(ctx, cs, playlists)
+	}
+	if ctx.Err() == nil {
+		if err := a.updateVideoIndex(ctx); err != nil {
+			log.Printf("cannot update %s: %s\n", videoIndexPath, err)
+		}
+		a.trackFailures(ctx, summary)
+	}
+	a.saveCaptionState()
+	if len(a.changes) == 0 {
+		log.Println("nothing selected, no commit made")
+		return ctx.Err()
+	}
+	commitCtx := ctx
+	if ctx.Err() != nil {
+		log.Printf("run interrupted, committing %d files\n", len(a.changes))
+		var cancel context.CancelFunc
+		commitCtx, cancel = context.WithTimeout(context.Background(), checkpointTimeout)
+		defer cancel()
+	}
+	commit, err := a.backend.Commit(commitCtx, a.head, commitMessage, a.changes)
+	if err != nil {
+		summary.CommitResult = "failed"
+		return err
+	}
+	// Hosts given only changes skip the commit when nothing changed.
+	if commit != a.head.Commit {
+		summary.CommitResult = "created"
+	}
+	summary.Commit = commit
+	// The issues and the sinks only get what the repository recorded.
+	if ctx.Err() == nil {
+		a.updateIssues(ctx)
+	}
+	a.writeSinks(commitCtx, summary)
+	if a.Config.ArchiveDir != "" && ctx.Err() == nil {
+		summary.Archive, err = a.exportArchive(ctx, a.Config.ArchiveDir, a.Config.ArchiveFormat, a.Config.ArchiveRelease, a.changes)
+		if err != nil {
+			log.Printf("cannot archive the run: %s\n", err)
+			if summary.Archive == nil {
+				summary.Archive = &ArchiveResult{}
+			}
+			summary.Archive.Error = err.Error()
+		}
+	}
+	return ctx.Err()
+}
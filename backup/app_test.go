@@ -0,0 +1,223 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rwapps/video_gists/internal/fake"
+)
+
+const (
+	topicFeed = `[
+		{"title": "Floods", "id": "PLfloods", "defaultImg": "https://i.ytimg.com/floods.jpg"},
+		{"title": "Refugees/Migrants Emergency - Europe", "id": "PLrefugees", "defaultImg": "https://i.ytimg.com/refugees.jpg"}
+	]`
+	organizationFeed = `{
+		"1503": {"name": "OCHA", "playlist_id": "PLocha", "thumbnail_url": "https://i.ytimg.com/ocha.jpg"}
+	}`
+)
+
+// testEnv is a backup wired to fakes of every upstream.
+type testEnv struct {
+	app       *App
+	youtube   *fake.YouTube
+	reliefweb *fake.ReliefWeb
+	github    *fake.GitHub
+}
+
+func videos(prefix string, n int) []fake.Video {
+	var vs []fake.Video
+	for i := 0; i < n; i++ {
+		vs = append(vs, fake.Video{Id: fmt.Sprintf("%s%d", prefix, i), Title: fmt.Sprintf("%s video %d", prefix, i)})
+	}
+	return vs
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	env := &testEnv{
+		youtube: fake.NewYouTube(map[string][]fake.Video{
+			"PLfloods":   videos("flood", 7),
+			"PLrefugees": videos("refugee", 2),
+			"PLocha":     videos("ocha", 3),
+		}),
+		reliefweb: fake.NewReliefWeb(map[string]string{
+			"topic":        topicFeed,
+			"organization": organizationFeed,
+		}),
+		github: fake.NewGitHub("rwapps", "video_backups", "master", map[string]string{
+			"README.md": "video backups\n",
+		}),
+	}
+	env.youtube.APIKey = "test-key"
+	t.Cleanup(func() {
+		env.youtube.Close()
+		env.reliefweb.Close()
+		env.github.Close()
+	})
+	config := Config{
+		Categories:   []string{"topic", "organization"},
+		YoutubeURL:   env.youtube.URL,
+		ReliefwebURL: env.reliefweb.URL,
+		GitHubURL:    env.github.URL,
+	}
+	app, err := NewApp(config, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.YoutubeAPIKey = "test-key"
+	env.app = app
+	return env
+}
+
+type playlistFile struct {
+	DefaultImg string  `json:"defaultImg"`
+	Videos     []Video `json:"videos"`
+}
+
+func readPlaylistFile(t *testing.T, files map[string]string, path string) playlistFile {
+	t.Helper()
+	content, ok := files[path]
+	if !ok {
+		t.Fatalf("%s missing from tree", path)
+	}
+	var f playlistFile
+	if err := json.Unmarshal([]byte(content), &f); err != nil {
+		t.Fatalf("%s: %s", path, err)
+	}
+	return f
+}
+
+func TestRun(t *testing.T) {
+	env := newTestEnv(t)
+	env.youtube.PageSize = 3
+	before := env.github.Head("master")
+
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	head := env.github.Head("master")
+	if head.SHA == before.SHA {
+		t.Fatal("branch was not updated")
+	}
+	if head.Message != "updating playlists" {
+		t.Errorf("commit message = %q", head.Message)
+	}
+	if len(head.Parents) != 1 || head.Parents[0] != before.SHA {
+		t.Errorf("commit parents = %v, want [%s]", head.Parents, before.SHA)
+	}
+
+	files := env.github.Files(head.SHA)
+	want := []string{
+		"README.md",
+		"topic/playlist.json",
+		"topic/Floods.json",
+		"topic/Refugees-Migrants Emergency - Europe.json",
+		"organization/playlist.json",
+		"organization/OCHA.json",
+		"videos/index.json",
+	}
+	if len(files) != len(want) {
+		t.Errorf("tree has %d files, want %d", len(files), len(want))
+	}
+	for _, path := range want {
+		if _, ok := files[path]; !ok {
+			t.Errorf("%s missing from tree", path)
+		}
+	}
+	if files["topic/playlist.json"] != topicFeed {
+		t.Error("topic feed was not stored verbatim")
+	}
+
+	floods := readPlaylistFile(t, files, "topic/Floods.json")
+	if floods.DefaultImg != "https://i.ytimg.com/floods.jpg" {
+		t.Errorf("defaultImg = %q", floods.DefaultImg)
+	}
+	if len(floods.Videos) != 7 {
+		t.Fatalf("got %d flood videos, want 7", len(floods.Videos))
+	}
+	for i, v := range floods.Videos {
+		if v.Position != i || v.Id != fmt.Sprintf("flood%d", i) {
+			t.Errorf("video %d = %+v", i, v)
+		}
+	}
+	ocha := readPlaylistFile(t, files, "organization/OCHA.json")
+	if len(ocha.Videos) != 3 || ocha.DefaultImg != "https://i.ytimg.com/ocha.jpg" {
+		t.Errorf("organization playlist = %+v", ocha)
+	}
+}
+
+func TestRunSelection(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.Selection = Selection{
+		Categories: ParseList("topic"),
+		Playlists:  ParseList("PLrefugees"),
+	}
+	before := env.github.Files(env.github.Head("master").SHA)
+
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	files := env.github.Files(env.github.Head("master").SHA)
+	// The playlist file and the video index.
+	if len(files) != len(before)+2 {
+		t.Fatalf("tree has %d files, want %d", len(files), len(before)+2)
+	}
+	readPlaylistFile(t, files, "topic/Refugees-Migrants Emergency - Europe.json")
+	if env.youtube.Requests["/playlistItems"] != 1 {
+		t.Errorf("made %d playlistItems requests, want 1", env.youtube.Requests["/playlistItems"])
+	}
+}
+
+func TestRunNothingSelected(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.Selection.Categories = ParseList("country")
+	before := env.github.Head("master")
+
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if env.github.Head("master").SHA != before.SHA {
+		t.Error("empty run made a commit")
+	}
+}
+
+// cancelAfter cancels a context once n playlistItems requests went through.
+type cancelAfter struct {
+	n      int
+	cancel context.CancelFunc
+	base   http.RoundTripper
+}
+
+func (c *cancelAfter) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := c.base.RoundTrip(req)
+	if strings.HasSuffix(req.URL.Path, "/playlistItems") {
+		if c.n--; c.n == 0 {
+			c.cancel()
+		}
+	}
+	return resp, err
+}
+
+func TestRunInterruptedCommitsCheckpoint(t *testing.T) {
+	env := newTestEnv(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	env.app.HTTPClient = &http.Client{Transport: &cancelAfter{n: 1, cancel: cancel, base: http.DefaultTransport}}
+
+	if err := env.app.Run(ctx); err != context.Canceled {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	files := env.github.Files(env.github.Head("master").SHA)
+	readPlaylistFile(t, files, "topic/Floods.json")
+	for _, path := range []string{"topic/Refugees-Migrants Emergency - Europe.json", "organization/playlist.json"} {
+		if _, ok := files[path]; ok {
+			t.Errorf("%s was fetched after the cancellation", path)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package backup
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// manifestPath is the first file of every archive.
+const manifestPath = "MANIFEST.json"
+
+// archiveTimeFormat dates the archive names, after archivePrefix.
+const archiveTimeFormat = "20060102T150405Z"
+
+const archivePrefix = "video-backups-"
+
+// releasePrefix tags the releases, with the date.
+const releasePrefix = "backup-"
+
+// blobCacheDir keeps, below the archive directory, the files of the last
+// archived tree by blob sha so the next archive only reads the new ones.
+const blobCacheDir = ".blobs"
+
+// Manifest describes the backup tree in an archive.
+type Manifest struct {
+	Created    time.Time      `json:"created"`
+	Repository string         `json:"repository"`
+	Branch     string         `json:"branch"`
+	Commit     string         `json:"commit"`
+	Files      []ManifestFile `json:"files"`
+}
+
+// ManifestFile is a file of the archive and its checksum.
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ArchiveResult describes an exported archive.
+type ArchiveResult struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+	// Release is the tag of the release the archive is attached to.
+	Release string `json:"release,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// validArchiveFormat reports whether format is supported, empty meaning
+// tar.gz.
+func validArchiveFormat(format string) bool {
+	return format == "" || format == "tar.gz" || format == "zip"
+}
+
+// ExportArchive writes the backup tree at the head of the branch to an
+// archive in dir and, when release is set, attaches it to the GitHub
+// release of the day. The files are cached in dir/.blobs between
+// archives. Config.ArchiveKeep then prunes the older archives.
+func (a *App) ExportArchive(ctx context.Context, dir, format string, release bool) (*ArchiveResult, error) {
+	return a.exportArchive(ctx, dir, format, release, nil)
+}
+
+// exportArchive reads the files of the head from staged when they are
+// unchanged there, saving the download.
+func (a *App) exportArchive(ctx context.Context, dir, format string, release bool, staged []Change) (*ArchiveResult, error) {
+	if !validArchiveFormat(format) {
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+	if release && a.Config.Backend != "github" {
+		return nil, fmt.Errorf("releases need the github backend, not %s", a.Config.Backend)
+	}
+	if format == "" {
+		format = "tar.gz"
+	}
+	head, err := a.backend.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files, err := a.snapshotFiles(ctx, head, staged, filepath.Join(dir, blobCacheDir))
+	if err != nil {
+		return nil, err
+	}
+	now := a.now().UTC()
+	m := &Manifest{
+		Created:    now,
+		Repository: a.Config.Owner + "/" + a.Config.Repo,
+		Branch:     a.Config.Branch,
+		Commit:     head.Commit,
+	}
+	name := fmt.Sprintf("%s%s.%s", archivePrefix, now.Format(archiveTimeFormat), format)
+	path, err := writeArchive(filepath.Join(dir, name), format, m, files)
+	if err != nil {
+		return nil, err
+	}
+	result := &ArchiveResult{Path: path, Files: len(files)}
+	log.Printf("archived %d files to %s\n", len(files), path)
+	if release {
+		if result.Release, err = a.attachToRelease(ctx, path, head.Commit); err != nil {
+			return result, err
+		}
+	}
+	if err := a.pruneArchives(ctx, dir, release); err != nil {
+		return result, fmt.Errorf("cannot prune the archives: %s", err)
+	}
+	return result, nil
+}
+
+// pruneArchives deletes the archives in dir and, with release, the
+// releases dated before the last Config.ArchiveKeep days.
+func (a *App) pruneArchives(ctx context.Context, dir string, release bool) error {
+	if a.Config.ArchiveKeep <= 0 {
+		return nil
+	}
+	oldest := a.now().UTC().AddDate(0, 0, 1-a.Config.ArchiveKeep).Format(dateFormat)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		stamp := strings.SplitN(strings.TrimPrefix(e.Name(), archivePrefix), ".", 2)[0]
+		t, err := time.Parse(archiveTimeFormat, stamp)
+		if err != nil || !strings.HasPrefix(e.Name(), archivePrefix) || t.Format(dateFormat) >= oldest {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+		log.Printf("removed the archive %s\n", e.Name())
+	}
+	if !release {
+		return nil
+	}
+
+	owner, repo := a.Config.Owner, a.Config.Repo
+	var old []*github.RepositoryRelease
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		releases, resp, err := a.github.Repositories.ListReleases(ctx, owner, repo, opt)
+		if err != nil {
+			return err
+		}
+		for _, r := range releases {
+			date := strings.TrimPrefix(r.GetTagName(), releasePrefix)
+			if _, err := time.Parse(dateFormat, date); err == nil && strings.HasPrefix(r.GetTagName(), releasePrefix) && date < oldest {
+				old = append(old, r)
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	for _, r := range old {
+		if _, err := a.github.Repositories.DeleteRelease(ctx, owner, repo, r.GetID()); err != nil {
+			return err
+		}
+		// The tag outlives its release.
+		resp, err := a.github.Git.DeleteRef(ctx, owner, repo, "tags/"+r.GetTagName())
+		if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusUnprocessableEntity) {
+			return err
+		}
+		log.Printf("deleted the release %s\n", r.GetTagName())
+	}
+	return nil
+}
+
+// snapshotFiles reads every file of s, from staged or the blob cache in
+// cacheDir when there, which then only keeps the files of s.
+func (a *App) snapshotFiles(ctx context.Context, s *Snapshot, staged []Change, cacheDir string) (map[string][]byte, error) {
+	known := map[string][]byte{}
+	for _, c := range staged {
+		if c.Delete {
+			continue
+		}
+		known[blobSHA(c.Content)] = c.Content
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	keep := map[string]bool{}
+	for path, sha := range s.Files {
+		keep[sha] = true
+		if content, ok := known[sha]; ok {
+			files[path] = content
+			continue
+		}
+		cached := filepath.Join(cacheDir, sha)
+		if content, err := ioutil.ReadFile(cached); err == nil && blobSHA(content) == sha {
+			files[path] = content
+			known[sha] = content
+			continue
+		}
+		content, err := a.backend.ReadFile(ctx, s, path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %s", path, err)
+		}
+		files[path] = content
+		known[sha] = content
+	}
+	// The cache is refreshed once the whole tree is read.
+	for sha := range keep {
+		cached := filepath.Join(cacheDir, sha)
+		if _, err := os.Stat(cached); err == nil {
+			continue
+		}
+		if err := ioutil.WriteFile(cached, known[sha], 0644); err != nil {
+			log.Printf("cannot cache %s: %s\n", sha, err)
+		}
+	}
+	if entries, err := ioutil.ReadDir(cacheDir); err == nil {
+		for _, e := range entries {
+			if !keep[e.Name()] {
+				os.Remove(filepath.Join(cacheDir, e.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+// writeArchive writes the manifest and files sorted by path to a
+// temporary file renamed to path once complete.
+func writeArchive(path, format string, m *Manifest, files map[string][]byte) (string, error) {
+	var paths []string
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	m.Files = nil
+	for _, p := range paths {
+		sum := sha256.Sum256(files[p])
+		m.Files = append(m.Files, ManifestFile{Path: p, Size: len(files[p]), SHA256: hex.EncodeToString(sum[:])})
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".archive")
+	if err != nil {
+		return "", fmt.Errorf("cannot create archive: %s", err)
+	}
+	defer os.Remove(f.Name())
+	add, close := archiveWriter(f, format)
+	err = add(manifestPath, manifest, m.Created)
+	for _, p := range paths {
+		if err != nil {
+			break
+		}
+		err = add(p, files[p], m.Created)
+	}
+	if err == nil {
+		err = close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot write archive %s: %s", path, err)
+	}
+	return path, nil
+}
+
+// archiveWriter returns the functions adding a file to an archive of
+// format written to w and finishing it.
+func archiveWriter(w io.Writer, format string) (func(string, []byte, time.Time) error, func() error) {
+	if format == "zip" {
+		zw := zip.NewWriter(w)
+		return func(name string, content []byte, modified time.Time) error {
+			fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+			if err != nil {
+				return err
+			}
+			_, err = fw.Write(content)
+			return err
+		}, zw.Close
+	}
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	return func(name string, content []byte, modified time.Time) error {
+			err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: modified, Typeflag: tar.TypeReg})
+			if err != nil {
+				return err
+			}
+			_, err = tw.Write(content)
+			return err
+		}, func() error {
+			if err := tw.Close(); err != nil {
+				return err
+			}
+			return gw.Close()
+		}
+}
+
+// attachToRelease uploads the archive at path to the release tagged with
+// the date, creating it on commit the first time of the day.
+func (a *App) attachToRelease(ctx context.Context, path, commit string) (string, error) {
+	owner, repo := a.Config.Owner, a.Config.Repo
+	tag := releasePrefix + a.now().UTC().Format(dateFormat)
+	release, resp, err := a.github.Repositories.GetReleaseByTag(ctx, owner, repo, tag)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		name := "Video backups " + a.now().UTC().Format(dateFormat)
+		release, _, err = a.github.Repositories.CreateRelease(ctx, owner, repo, &github.RepositoryRelease{
+			TagName:         github.String(tag),
+			TargetCommitish: github.String(commit),
+			Name:            github.String(name),
+			Body:            github.String("Archives of the video backups made on " + a.now().UTC().Format(dateFormat) + "."),
+		})
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot get release %s: %s", tag, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	opt := &github.UploadOptions{Name: filepath.Base(path)}
+	if _, _, err := a.github.Repositories.UploadReleaseAsset(ctx, owner, repo, release.GetID(), opt, f); err != nil {
+		return "", fmt.Errorf("cannot attach %s to release %s: %s", opt.Name, tag, err)
+	}
+	return tag, nil
+}
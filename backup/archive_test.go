@@ -0,0 +1,253 @@
+package backup
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readTarGz returns the files of an archive in order.
+func readTarGz(t *testing.T, path string) ([]string, map[string][]byte) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	var names []string
+	files := map[string][]byte{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return names, files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, h.Name)
+		files[h.Name] = content
+	}
+}
+
+// checkManifest compares the manifest of an archive to its files.
+func checkManifest(t *testing.T, files map[string][]byte, commit string) {
+	var m Manifest
+	if err := json.Unmarshal(files[manifestPath], &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Commit != commit || m.Repository != "rwapps/video_backups" || len(m.Files) != len(files)-1 {
+		t.Errorf("manifest = %+v", m)
+	}
+	for _, f := range m.Files {
+		sum := sha256.Sum256(files[f.Path])
+		if hex.EncodeToString(sum[:]) != f.SHA256 || len(files[f.Path]) != f.Size {
+			t.Errorf("manifest entry %+v does not match the archive", f)
+		}
+	}
+}
+
+func TestRunArchive(t *testing.T) {
+	env := newTestEnv(t)
+	config := env.app.Config
+	config.ArchiveDir = t.TempDir()
+	config.ArchiveRelease = true
+	config.GitHubUploadURL = env.github.URL
+	app, err := NewApp(config, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.YoutubeAPIKey = "test-key"
+	app.now = func() time.Time { return time.Date(2026, 10, 19, 6, 30, 0, 0, time.UTC) }
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	result := app.LastRun.Archive
+	want := filepath.Join(config.ArchiveDir, "video-backups-20261019T063000Z.tar.gz")
+	if result == nil || result.Path != want || result.Release != "backup-2026-10-19" || result.Error != "" {
+		t.Fatalf("archive = %+v", result)
+	}
+
+	names, files := readTarGz(t, result.Path)
+	if names[0] != manifestPath {
+		t.Errorf("archive starts with %s", names[0])
+	}
+	head := env.github.Head("master")
+	tree := env.github.Files(head.SHA)
+	if len(files) != len(tree)+1 || result.Files != len(tree) {
+		t.Errorf("archive has %d files, the tree %d", len(files), len(tree))
+	}
+	for path, content := range tree {
+		if string(files[path]) != content {
+			t.Errorf("%s differs from the tree", path)
+		}
+	}
+	checkManifest(t, files, head.SHA)
+
+	// Later runs of the day add assets to the same release.
+	app.now = func() time.Time { return time.Date(2026, 10, 19, 18, 30, 0, 0, time.UTC) }
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	releases := env.github.Releases()
+	if len(releases) != 1 || releases[0].TagName != "backup-2026-10-19" || releases[0].Target != head.SHA {
+		t.Fatalf("releases = %+v", releases)
+	}
+	assets := releases[0].Assets
+	if len(assets) != 2 || assets[1].Name != "video-backups-20261019T183000Z.tar.gz" {
+		t.Fatalf("assets = %+v", assets)
+	}
+	data, err := ioutil.ReadFile(result.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(assets[0].Content) != string(data) {
+		t.Error("the asset differs from the archive")
+	}
+}
+
+func TestExportArchiveZip(t *testing.T) {
+	env := newTestEnv(t)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	result, err := env.app.ExportArchive(context.Background(), t.TempDir(), "zip", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.OpenReader(result.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	files := map[string][]byte{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = ioutil.ReadAll(rc)
+		rc.Close()
+	}
+	if r.File[0].Name != manifestPath {
+		t.Errorf("archive starts with %s", r.File[0].Name)
+	}
+	checkManifest(t, files, env.github.Head("master").SHA)
+	if len(env.github.Releases()) != 0 {
+		t.Error("release created without asking")
+	}
+}
+
+func TestExportArchiveCachesBlobs(t *testing.T) {
+	env := newTestEnv(t)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	blobReads := func() int {
+		n := 0
+		for key, count := range env.github.Requests {
+			if strings.HasPrefix(key, "GET /repos/rwapps/video_backups/git/blobs/") {
+				n += count
+			}
+		}
+		return n
+	}
+	dir := t.TempDir()
+	if _, err := env.app.ExportArchive(context.Background(), dir, "", false); err != nil {
+		t.Fatal(err)
+	}
+	reads := blobReads()
+	if reads == 0 {
+		t.Fatal("the first archive read no blobs")
+	}
+	env.app.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := env.app.ExportArchive(context.Background(), dir, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if n := blobReads() - reads; n != 0 {
+		t.Errorf("the second archive read %d blobs", n)
+	}
+}
+
+func TestArchiveConfig(t *testing.T) {
+	for _, c := range []Config{
+		{ArchiveFormat: "rar"},
+		{ArchiveRelease: true, Backend: "gitlab"},
+	} {
+		if _, err := NewApp(c, nil, nil); err == nil {
+			t.Errorf("config %+v accepted", c)
+		}
+	}
+}
+
+func TestArchiveKeep(t *testing.T) {
+	env := newTestEnv(t)
+	config := env.app.Config
+	config.ArchiveDir = t.TempDir()
+	config.ArchiveRelease = true
+	config.ArchiveKeep = 2
+	config.GitHubUploadURL = env.github.URL
+	app, err := NewApp(config, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.YoutubeAPIKey = "test-key"
+	for _, day := range []int{17, 18, 19} {
+		app.now = func() time.Time { return time.Date(2026, 10, day, 6, 30, 0, 0, time.UTC) }
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if app.LastRun.Archive == nil || app.LastRun.Archive.Error != "" {
+			t.Fatalf("archive = %+v", app.LastRun.Archive)
+		}
+	}
+	entries, err := ioutil.ReadDir(config.ArchiveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{".blobs", "video-backups-20261018T063000Z.tar.gz", "video-backups-20261019T063000Z.tar.gz"}; strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("archive directory holds %v, want %v", names, want)
+	}
+	releases := env.github.Releases()
+	if len(releases) != 2 || releases[0].TagName != "backup-2026-10-18" || releases[1].TagName != "backup-2026-10-19" {
+		t.Errorf("releases = %+v", releases)
+	}
+	if env.github.Requests["DELETE /repos/rwapps/video_backups/git/refs/tags/backup-2026-10-17"] != 1 {
+		t.Error("the tag of the deleted release was kept")
+	}
+}
+
+func TestExportArchiveReleaseNeedsGitHub(t *testing.T) {
+	env := newTestEnv(t)
+	app, _ := newGitLabApp(t, env)
+	dir := t.TempDir()
+	_, err := app.ExportArchive(context.Background(), dir, "", true)
+	if err == nil || !strings.Contains(err.Error(), "github backend") {
+		t.Fatalf("err = %v", err)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("archived without a release: %d entries", len(entries))
+	}
+}
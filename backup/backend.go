@@ -0,0 +1,150 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// commitMessage describes the commits of every run.
+const commitMessage = "updating playlists"
+
+// runStateDir holds what runs keep between them rather than backed up
+// data.
+const runStateDir = ".backup/"
+
+// Backend hosts the backup repository.
+type Backend interface {
+	// Head resolves the backup branch.
+	Head(ctx context.Context) (*Snapshot, error)
+	// ReadFile returns the content of a file of s.
+	ReadFile(ctx context.Context, s *Snapshot, path string) ([]byte, error)
+	// Commit records changes on top of base, moves the branch to the new
+	// commit and returns it.
+	Commit(ctx context.Context, base *Snapshot, message string, changes []Change) (string, error)
+	// Check reports whether the credentials can write to the repository.
+	Check(ctx context.Context) (string, error)
+}
+
+// Snapshot is a commit of the backup branch.
+type Snapshot struct {
+	Commit string
+	// Tree is the root tree of Commit, when the host exposes it.
+	Tree string
+	// Files maps every path to its git blob SHA.
+	Files map[string]string
+}
+
+// Change writes Content to Path, or removes Path when Delete is set.
+type Change struct {
+	Path    string
+	Content []byte
+	Delete  bool
+}
+
+// blobSHA is the git object id of content, which the hosts use to tell
+// unchanged files.
+func blobSHA(content []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(append([]byte(fmt.Sprintf("blob %d\x00", len(content))), content...)))
+}
+
+// changed drops the changes leaving their file as it is in base, the
+// hosts without trees to share refuse or duplicate them.
+func changed(base *Snapshot, changes []Change) []Change {
+	var out []Change
+	for _, c := range changes {
+		sha, ok := base.Files[c.Path]
+		if c.Delete && ok || !c.Delete && (!ok || sha != blobSHA(c.Content)) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// staleHead is the error of a commit the host refused because the branch
+// moved since base, the next run starting over from the new head.
+func staleHead(base *Snapshot, err error) error {
+	return fmt.Errorf("the branch moved since %.7s: %s", base.Commit, err)
+}
+
+// apiError is an error response of a host, StatusCode telling conflicts
+// apart.
+type apiError struct {
+	StatusCode int
+	message    string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// hasStatus reports whether err is an error response with status.
+func hasStatus(err error, status int) bool {
+	e, ok := err.(*apiError)
+	return ok && e.StatusCode == status
+}
+
+// newBackend builds the backend named by Config.Backend.
+func (a *App) newBackend() (Backend, error) {
+	c := a.Config
+	switch c.Backend {
+	case "github":
+		return &githubBackend{client: a.github, http: a.GitHubClient, owner: c.Owner, repo: c.Repo, branch: c.Branch}, nil
+	case "gitlab":
+		return &gitlabBackend{http: a.GitHubClient, base: strings.TrimSuffix(c.GitLabURL, "/"), project: c.Owner + "/" + c.Repo, branch: c.Branch}, nil
+	case "gitea":
+		if c.GiteaURL == "" {
+			return nil, fmt.Errorf("the gitea backend needs GiteaURL")
+		}
+		return &giteaBackend{http: a.GitHubClient, base: strings.TrimSuffix(c.GiteaURL, "/"), owner: c.Owner, repo: c.Repo, branch: c.Branch}, nil
+	case "local":
+		return newLocalBackend(c.LocalRepo, c.Branch)
+	}
+	return nil, fmt.Errorf("unknown backend %q", c.Backend)
+}
+
+// apiRequest sends input as JSON and decodes the response into output
+// unless it is nil, returning the response headers and body. Any status
+// but 2xx is an error.
+func apiRequest(ctx context.Context, client *http.Client, verb, u string, input, output interface{}) (http.Header, []byte, error) {
+	var body *bytes.Reader
+	if input != nil {
+		data, err := json.Marshal(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		body = bytes.NewReader(data)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(verb, u, body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot make request for %s: %s", u, err)
+	}
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot %s %s: %s", verb, u, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to readall body %s", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, nil, &apiError{resp.StatusCode, fmt.Sprintf("%s %s returned %s: %s", verb, req.URL.Path, resp.Status, bytes.TrimSpace(data))}
+	}
+	if output != nil {
+		if err := json.Unmarshal(data, output); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode resp.Body %s", err)
+		}
+	}
+	return resp.Header, data, nil
+}
@@ -0,0 +1,142 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// cacheEntry is a cached response, stored as JSON in the cache directory.
+type cacheEntry struct {
+	URL          string      `json:"url"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"lastModified,omitempty"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+}
+
+// CacheStats counts the requests answered from the cache.
+type CacheStats struct {
+	Hits       int64
+	QuotaSaved int64
+}
+
+// caching revalidates the GET requests to YouTube and ReliefWeb with the
+// validators of their previous response, answering from the cache when
+// the server replies 304 Not Modified.
+type caching struct {
+	app  *App
+	dir  string
+	base http.RoundTripper
+}
+
+// cachePath names the entry of u after its hash, credentials redacted so
+// a new API key keeps the cache.
+func (t *caching) cachePath(u string) string {
+	return filepath.Join(t.dir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(u))))
+}
+
+func (t *caching) load(path, u string) *cacheEntry {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.URL != u {
+		return nil
+	}
+	return &e
+}
+
+// save writes e atomically, a broken cache only costs a full download.
+func (t *caching) save(path string, e *cacheEntry) {
+	data, err := json.Marshal(e)
+	if err == nil {
+		err = os.MkdirAll(t.dir, 0755)
+	}
+	var tmp *os.File
+	if err == nil {
+		tmp, err = ioutil.TempFile(t.dir, ".entry")
+	}
+	if err == nil {
+		_, err = tmp.Write(data)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}
+	if err != nil {
+		log.Printf("cannot cache %s: %s\n", e.URL, err)
+	}
+}
+
+func (t *caching) RoundTrip(req *http.Request) (*http.Response, error) {
+	upstream, units := t.app.upstream(req)
+	if req.Method != "GET" || (upstream != "youtube" && upstream != "reliefweb") {
+		return t.base.RoundTrip(req)
+	}
+	u := redactURL(req.URL)
+	path := t.cachePath(u)
+	entry := t.load(path, u)
+	if entry != nil {
+		req = req.Clone(req.Context())
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		resp.Body.Close()
+		atomic.AddInt64(&t.app.cacheStats.Hits, 1)
+		atomic.AddInt64(&t.app.cacheStats.QuotaSaved, int64(units))
+		t.app.Metrics.cacheHit(upstream, units)
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		resp.Header = entry.Header.Clone()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(entry.Body))
+		resp.ContentLength = int64(len(entry.Body))
+	case resp.StatusCode == http.StatusOK:
+		etag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		if etag == "" && modified == "" {
+			break
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		t.save(path, &cacheEntry{URL: u, ETag: etag, LastModified: modified, Header: resp.Header, Body: body})
+	}
+	return resp, nil
+}
+
+// cache returns a copy of c answering from Config.CacheDir, c itself when
+// there is no cache.
+func (a *App) cache(c *http.Client) *http.Client {
+	if a.Config.CacheDir == "" {
+		return c
+	}
+	client := *c
+	client.Transport = &caching{app: a, dir: a.Config.CacheDir, base: c.Transport}
+	return &client
+}
@@ -0,0 +1,82 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rwapps/video_gists/internal/fake"
+)
+
+func TestRunRevalidatesCachedResponses(t *testing.T) {
+	env := newTestEnv(t)
+	dir := t.TempDir()
+	config := env.app.Config
+	config.CacheDir = dir
+	app, err := NewApp(config, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.YoutubeAPIKey = "test-key"
+
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if app.LastRun.CacheHits != 0 {
+		t.Errorf("first run had %d cache hits", app.LastRun.CacheHits)
+	}
+	entries, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(entries) != 5 {
+		t.Errorf("cached %d responses, want 5", len(entries))
+	}
+	for _, e := range entries {
+		data, _ := ioutil.ReadFile(e)
+		if strings.Contains(string(data), "test-key") {
+			t.Errorf("%s holds the API key", e)
+		}
+	}
+
+	// Two feeds and three playlists, one page each.
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if app.LastRun.CacheHits != 5 || app.LastRun.QuotaSaved != 3 {
+		t.Errorf("second run: %d hits saving %d units, want 5 and 3", app.LastRun.CacheHits, app.LastRun.QuotaSaved)
+	}
+	if env.reliefweb.NotModified != 2 {
+		t.Errorf("reliefweb answered %d requests with 304, want 2", env.reliefweb.NotModified)
+	}
+	if app.LastRun.Categories[0].Videos != 9 {
+		t.Errorf("cached run backed up %d topic videos, want 9", app.LastRun.Categories[0].Videos)
+	}
+
+	var b bytes.Buffer
+	app.Metrics.WriteTo(&b)
+	for _, want := range []string{
+		`video_backup_cache_hits_total{upstream="youtube"} 3`,
+		`video_backup_cache_hits_total{upstream="reliefweb"} 2`,
+		`video_backup_quota_saved_units_total{upstream="youtube"} 3`,
+		// Only the first run spent quota.
+		`video_backup_api_quota_units_total{upstream="youtube"} 3`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+
+	// Changed resources are downloaded again.
+	env.youtube.SetPlaylist("PLocha", []fake.Video{{Id: "new", Title: "New"}})
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if app.LastRun.CacheHits != 4 {
+		t.Errorf("third run had %d cache hits, want 4", app.LastRun.CacheHits)
+	}
+	ocha := readPlaylistFile(t, env.github.Files(env.github.Head("master").SHA), "organization/OCHA.json")
+	if len(ocha.Videos) != 1 || ocha.Videos[0].Id != "new" {
+		t.Errorf("organization playlist = %+v", ocha)
+	}
+}
@@ -0,0 +1,245 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// captionTrack is an item of captions.list.
+type captionTrack struct {
+	Id      string `json:"id"`
+	Snippet struct {
+		Language  string `json:"language"`
+		TrackKind string `json:"trackKind"`
+	} `json:"snippet"`
+}
+
+// captionPath is where a track of a video in the playlist file at path
+// lives: in a directory named after the playlist file, one file per video,
+// language and kind.
+func captionPath(path, videoId string, t captionTrack) string {
+	name := videoId + "." + strings.Replace(t.Snippet.Language, "/", "-", -1)
+	if t.Snippet.TrackKind == "asr" {
+		name += ".asr"
+	}
+	return strings.TrimSuffix(path, ".json") + "/" + name + ".vtt"
+}
+
+// wantsLanguage applies Config.CaptionLanguages.
+func (a *App) wantsLanguage(language string) bool {
+	if len(a.Config.CaptionLanguages) == 0 {
+		return true
+	}
+	for _, l := range a.Config.CaptionLanguages {
+		if strings.EqualFold(l, language) {
+			return true
+		}
+	}
+	return false
+}
+
+// captionStatePath keeps the caption budget of the day and the videos
+// whose tracks were listed, so neither is spent again by the next runs.
+const captionStatePath = runStateDir + "captions.json"
+
+// captionRecheck is how long a listed video is not listed again, in case
+// captions were added since.
+const captionRecheck = 30 * 24 * time.Hour
+
+// captionState is the content of captionStatePath.
+type captionState struct {
+	// Day is the UTC day Units were spent on.
+	Day   string `json:"day"`
+	Units int    `json:"units"`
+	// Checked maps the videos listed to the day they were.
+	Checked map[string]string `json:"checked"`
+}
+
+// loadCaptionState reads the caption state of the base, once per run.
+func (a *App) loadCaptionState(ctx context.Context) *captionState {
+	if a.captions != nil {
+		return a.captions
+	}
+	a.captions = &captionState{Checked: map[string]string{}}
+	content, err := a.readBase(ctx, captionStatePath)
+	if err != nil {
+		log.Printf("cannot read %s: %s\n", captionStatePath, err)
+	} else if content != nil {
+		if err := json.Unmarshal(content, a.captions); err != nil {
+			log.Printf("ignoring invalid %s: %s\n", captionStatePath, err)
+		}
+		a.captionsBase = string(content)
+	}
+	if a.captions.Checked == nil {
+		a.captions.Checked = map[string]string{}
+	}
+	today, _ := time.Parse(dateFormat, a.day)
+	for id, day := range a.captions.Checked {
+		if t, err := time.Parse(dateFormat, day); err != nil || today.Sub(t) > captionRecheck {
+			delete(a.captions.Checked, id)
+		}
+	}
+	return a.captions
+}
+
+// saveCaptionState stages the caption state when the run changed it.
+func (a *App) saveCaptionState() {
+	if a.captions == nil {
+		return
+	}
+	data, err := json.MarshalIndent(a.captions, "", "  ")
+	if err != nil {
+		log.Printf("cannot encode %s: %s\n", captionStatePath, err)
+		return
+	}
+	if string(data) != a.captionsBase {
+		a.addToTree(captionStatePath, string(data))
+	}
+}
+
+// spendCaptionQuota reserves units of the daily caption quota, reporting
+// false once it would be exceeded.
+func (a *App) spendCaptionQuota(state *captionState, units int) bool {
+	if a.captionsCapped {
+		return false
+	}
+	if state.Day != a.day {
+		state.Day, state.Units = a.day, 0
+	}
+	if state.Units+units > a.Config.CaptionQuota {
+		log.Printf("caption quota of %d units a day spent, skipping the remaining captions\n", a.Config.CaptionQuota)
+		a.captionsCapped = true
+		return false
+	}
+	state.Units += units
+	return true
+}
+
+// captionsArchived reports whether a track of the video is in the base,
+// indexing the tracks of the base by playlist and video the first time.
+func (a *App) captionsArchived(path, videoId string) bool {
+	if a.archivedCaptions == nil {
+		a.archivedCaptions = map[string]bool{}
+		for p := range a.head.Files {
+			if !strings.HasSuffix(p, ".vtt") {
+				continue
+			}
+			i := strings.LastIndex(p, "/") + 1
+			a.archivedCaptions[p[:i]+strings.SplitN(p[i:], ".", 2)[0]] = true
+		}
+	}
+	return a.archivedCaptions[strings.TrimSuffix(path, ".json")+"/"+videoId]
+}
+
+// archiveCaptions stores the WebVTT tracks of videos next to the playlist
+// file at path. Videos with archived tracks or listed recently are
+// skipped. Downloading needs OAuth for the channel owning the videos,
+// without it no quota is spent on captions. Failures are only logged:
+// captions never fail a backup.
+func (a *App) archiveCaptions(ctx context.Context, cs *CategorySummary, path string, videos []Video) {
+	if a.YoutubeOAuthClient == nil {
+		if !a.captionsCapped {
+			log.Printf("caption downloads need YouTube OAuth, skipping the captions\n")
+			a.captionsCapped = true
+		}
+		return
+	}
+	state := a.loadCaptionState(ctx)
+	client := a.instrument(a.YoutubeOAuthClient)
+	for _, v := range videos {
+		if v.Unavailable() {
+			continue
+		}
+		if _, ok := state.Checked[v.Id]; ok || a.captionsArchived(path, v.Id) {
+			continue
+		}
+		if ctx.Err() != nil || !a.spendCaptionQuota(state, youtubeQuota["GET captions"]) {
+			return
+		}
+		tracks, err := a.listCaptions(ctx, v.Id)
+		if err != nil {
+			log.Printf("cannot list the captions of %s: %s\n", v.Id, err)
+			continue
+		}
+		state.Checked[v.Id] = a.day
+		for _, t := range tracks {
+			if !a.wantsLanguage(t.Snippet.Language) {
+				continue
+			}
+			p := captionPath(path, v.Id, t)
+			if !a.spendCaptionQuota(state, youtubeQuota["GET captions/{id}"]) {
+				return
+			}
+			vtt, err := a.downloadCaption(ctx, client, t.Id)
+			if err != nil {
+				log.Printf("cannot download the %s captions of %s: %s\n", t.Snippet.Language, v.Id, err)
+				continue
+			}
+			a.addToTree(p, string(vtt))
+			cs.Captions++
+		}
+	}
+}
+
+func (a *App) listCaptions(ctx context.Context, videoId string) ([]captionTrack, error) {
+	q := url.Values{}
+	q.Set("part", "snippet")
+	q.Set("videoId", videoId)
+	q.Set("key", a.YoutubeAPIKey)
+	body, err := a.youtubeGet(ctx, "/captions?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Items []captionTrack `json:"items"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode captions %s", err)
+	}
+	return result.Items, nil
+}
+
+// downloadCaption downloads a track with the OAuth client, the API key
+// cannot.
+func (a *App) downloadCaption(ctx context.Context, client *http.Client, id string) ([]byte, error) {
+	return a.youtubeGetWith(ctx, client, "/captions/"+url.PathEscape(id)+"?tfmt=vtt")
+}
+
+// youtubeGet reads the YouTube Data API resource at path, turning error
+// responses into their reason.
+func (a *App) youtubeGet(ctx context.Context, path string) ([]byte, error) {
+	return a.youtubeGetWith(ctx, a.HTTPClient, path)
+}
+
+// youtubeGetWith is youtubeGet with another client.
+func (a *App) youtubeGetWith(ctx context.Context, client *http.Client, path string) ([]byte, error) {
+	req, err := http.NewRequest("GET", a.Config.YoutubeURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get from gapis %s", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e youtubeError
+		json.Unmarshal(body, &e)
+		if len(e.Error.Errors) > 0 {
+			return nil, fmt.Errorf("gapis returned %s: %s", resp.Status, e.Error.Errors[0].Reason)
+		}
+		return nil, fmt.Errorf("gapis returned %s", resp.Status)
+	}
+	return body, nil
+}
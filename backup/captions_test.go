@@ -0,0 +1,142 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rwapps/video_gists/internal/fake"
+	"golang.org/x/oauth2"
+)
+
+func captionedPlaylist() []fake.Video {
+	return []fake.Video{
+		{Id: "a", Title: "A", Captions: []fake.Caption{
+			{Id: "a-en", Language: "en", Kind: "standard", VTT: "WEBVTT\n\n00:00.000 --> 00:01.000\nHello\n"},
+			{Id: "a-fr", Language: "fr", Kind: "asr", VTT: "WEBVTT\n\n00:00.000 --> 00:01.000\nBonjour\n"},
+			{Id: "a-es", Language: "es", Kind: "standard", VTT: "WEBVTT\n"},
+			{Id: "a-en-owner", Language: "en-GB", Kind: "standard"},
+		}},
+		{Id: "b", Title: "B"},
+		{Id: "c", Title: "Private video"},
+	}
+}
+
+// oauthClient authorizes requests with a static bearer token.
+func oauthClient(token string) *http.Client {
+	return oauth2.NewClient(oauth2.NoContext, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+}
+
+func readCaptionState(t *testing.T, env *testEnv) captionState {
+	t.Helper()
+	var state captionState
+	content := env.github.Files(env.github.Head("master").SHA)[captionStatePath]
+	if err := json.Unmarshal([]byte(content), &state); err != nil {
+		t.Fatalf("%s: %s", captionStatePath, err)
+	}
+	return state
+}
+
+func TestRunArchivesCaptions(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.Config.Captions = true
+	env.app.Config.CaptionLanguages = []string{"en", "FR", "en-GB"}
+	env.app.Selection.Playlists = ParseList("PLfloods")
+	env.app.YoutubeOAuthClient = oauthClient("oauth-token")
+	env.youtube.SetPlaylist("PLfloods", captionedPlaylist())
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	files := env.github.Files(env.github.Head("master").SHA)
+	if got := files["topic/Floods/a.en.vtt"]; got != "WEBVTT\n\n00:00.000 --> 00:01.000\nHello\n" {
+		t.Errorf("a.en.vtt = %q", got)
+	}
+	if _, ok := files["topic/Floods/a.fr.asr.vtt"]; !ok {
+		t.Error("the automatic French track is missing")
+	}
+	for _, path := range []string{"topic/Floods/a.es.vtt", "topic/Floods/a.en-GB.vtt"} {
+		if _, ok := files[path]; ok {
+			t.Errorf("%s archived", path)
+		}
+	}
+	if n := env.app.LastRun.Categories[0].Captions; n != 2 {
+		t.Errorf("summary has %d captions, want 2", n)
+	}
+	// Two lists, the private video is skipped, and three downloads.
+	if n := env.youtube.Requests["/captions"]; n != 2 {
+		t.Errorf("listed captions %d times, want 2", n)
+	}
+	state := readCaptionState(t, env)
+	if state.Units != 2*50+3*200 || len(state.Checked) != 2 {
+		t.Errorf("caption state = %+v", state)
+	}
+
+	// Listed videos are not listed again, nor their tracks downloaded.
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.youtube.Requests["/captions"]; n != 2 {
+		t.Errorf("listed captions %d times after the second run, want 2", n)
+	}
+	if state := readCaptionState(t, env); state.Units != 2*50+3*200 {
+		t.Errorf("spent %d caption units by the second run", state.Units)
+	}
+	if _, ok := env.github.Files(env.github.Head("master").SHA)["topic/Floods/a.en.vtt"]; !ok {
+		t.Error("the second run dropped the archived track")
+	}
+}
+
+func TestRunCaptionsNeedOAuth(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.Config.Captions = true
+	env.youtube.SetPlaylist("PLfloods", captionedPlaylist())
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.youtube.Requests["/captions"]; n != 0 {
+		t.Errorf("spent quota on %d caption requests without OAuth", n)
+	}
+	if env.app.LastRun.Failed() {
+		t.Errorf("the missing OAuth failed the run: %+v", env.app.LastRun)
+	}
+}
+
+func TestRunCaptionQuota(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.Config.Captions = true
+	env.app.Config.CaptionQuota = 60
+	env.app.YoutubeOAuthClient = oauthClient("oauth-token")
+	env.youtube.SetPlaylist("PLfloods", captionedPlaylist())
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.youtube.Requests["/captions"]; n != 1 {
+		t.Errorf("listed captions %d times, want 1", n)
+	}
+	if env.app.LastRun.Failed() {
+		t.Errorf("the spent quota failed the run: %+v", env.app.LastRun)
+	}
+	files := env.github.Files(env.github.Head("master").SHA)
+	if _, ok := files["topic/Floods.json"]; !ok {
+		t.Error("the playlist was not backed up")
+	}
+
+	// The budget is daily: later runs of the day spend nothing, the next
+	// day lists the following video.
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.youtube.Requests["/captions"]; n != 1 {
+		t.Errorf("listed captions %d times the same day, want 1", n)
+	}
+	env.app.now = func() time.Time { return time.Now().Add(24 * time.Hour) }
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.youtube.Requests["/captions"]; n != 2 {
+		t.Errorf("listed captions %d times the next day, want 2", n)
+	}
+}
@@ -0,0 +1,234 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// redactedParams are query parameters holding credentials, they never
+// reach a cassette.
+var redactedParams = []string{"key", "access_token"}
+
+// Cassette is a recording of the HTTP exchanges of a run. Recording wraps
+// the real transports, replaying answers from the recording without any
+// network access.
+type Cassette struct {
+	// Time is when the recorded run started, a replay runs at that time
+	// as the dates it writes must match.
+	Time time.Time `json:"time"`
+	// OAuth is set when the recorded run had YouTube OAuth, which its
+	// replay then uses without the credentials.
+	OAuth        bool           `json:"oauth,omitempty"`
+	Interactions []*Interaction `json:"interactions"`
+
+	mu   sync.Mutex
+	used []bool
+}
+
+// Interaction is one recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   Body   `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	Status     string      `json:"status"`
+	StatusCode int         `json:"code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Body keeps text readable in the cassette and base64 encodes anything
+// else.
+type Body []byte
+
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string][]byte{"base64": b})
+}
+
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = Body(s)
+		return nil
+	}
+	var encoded map[string][]byte
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	*b = encoded["base64"]
+	return nil
+}
+
+// LoadCassette reads a cassette written by Save.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read cassette: %s", err)
+	}
+	c := &Cassette{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %s", path, err)
+	}
+	return c, nil
+}
+
+// Save writes the recorded exchanges to path.
+func (c *Cassette) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// redactURL replaces the credentials in u.
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	for _, p := range redactedParams {
+		if q.Get(p) != "" {
+			q.Set(p, "REDACTED")
+		}
+	}
+	r := *u
+	r.RawQuery = q.Encode()
+	return r.String()
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+type recorder struct {
+	cassette *Cassette
+	base     http.RoundTripper
+}
+
+// Record returns a transport that sends requests through base, nil meaning
+// http.DefaultTransport, and appends every exchange to c.
+func (c *Cassette) Record(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &recorder{cassette: c, base: base}
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	header := http.Header{}
+	for k, v := range resp.Header {
+		if k != "Set-Cookie" {
+			header[k] = v
+		}
+	}
+	r.cassette.mu.Lock()
+	defer r.cassette.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{
+		Request: RecordedRequest{Method: req.Method, URL: redactURL(req.URL), Body: reqBody},
+		Response: RecordedResponse{
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       respBody,
+		},
+	})
+	return resp, nil
+}
+
+type replayer struct {
+	cassette *Cassette
+}
+
+// Replay returns a transport answering from the recorded exchanges. A
+// request matches the first unused exchange with the same method, url and
+// body, so a replayed run only succeeds if it sends exactly what was
+// recorded.
+func (c *Cassette) Replay() http.RoundTripper {
+	return &replayer{cassette: c}
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	u := redactURL(req.URL)
+	c := r.cassette
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.used == nil {
+		c.used = make([]bool, len(c.Interactions))
+	}
+	for i, in := range c.Interactions {
+		if c.used[i] || in.Request.Method != req.Method || in.Request.URL != u || !bytes.Equal(in.Request.Body, body) {
+			continue
+		}
+		c.used[i] = true
+		return &http.Response{
+			Status:        in.Response.Status,
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header,
+			Body:          ioutil.NopCloser(bytes.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded exchange for %s %s (body %s)", req.Method, u, summarize(body))
+}
+
+// summarize shortens a request body for error messages.
+func summarize(body []byte) string {
+	s := strings.TrimSpace(string(body))
+	if len(s) > 200 {
+		s = s[:200] + "..."
+	}
+	if s == "" {
+		return "empty"
+	}
+	return s
+}
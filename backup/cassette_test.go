@@ -0,0 +1,104 @@
+package backup
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	env := newTestEnv(t)
+	slack := newReceiver(t)
+	env.app.Config.Notifications = []Notification{{Type: "slack", URL: slack.URL + "/services/T0/B0/webhook-secret"}}
+	cassette := &Cassette{}
+	record := &http.Client{Transport: cassette.Record(nil)}
+	app, err := NewApp(env.app.Config, record, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.YoutubeAPIKey = "test-key"
+	app.SetClock(func() time.Time { return time.Date(2025, 6, 1, 23, 59, 0, 0, time.UTC) })
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	cassette.Time = app.LastRun.Start
+	path := filepath.Join(t.TempDir(), "run.json")
+	if err := cassette.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "test-key") {
+		t.Error("cassette contains the API key")
+	}
+	if strings.Contains(string(data), "webhook-secret") || len(slack.bodies) != 1 {
+		t.Errorf("the notification was recorded or not sent, %d sent", len(slack.bodies))
+	}
+
+	// Replay with every server gone.
+	env.youtube.Close()
+	env.reliefweb.Close()
+	env.github.Close()
+	loaded, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := &http.Client{Transport: loaded.Replay()}
+	replayed, err := NewApp(env.app.Config, replay, replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed.YoutubeAPIKey = "another-key"
+	replayed.NotifyClient = nil
+	// Replayed days later, at the time of the recording.
+	replayed.SetClock(func() time.Time { return loaded.Time })
+	if err := replayed.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if replayed.LastRun.Commit != app.LastRun.Commit {
+		t.Errorf("replay produced commit %s, recorded commit %s", replayed.LastRun.Commit, app.LastRun.Commit)
+	}
+	if len(slack.bodies) != 1 {
+		t.Errorf("the replay notified again")
+	}
+}
+
+func TestCassetteReplayMismatch(t *testing.T) {
+	c := &Cassette{Interactions: []*Interaction{{
+		Request:  RecordedRequest{Method: "POST", URL: "http://example.org/trees", Body: Body(`{"a":1}`)},
+		Response: RecordedResponse{Status: "201 Created", StatusCode: 201, Body: Body(`{"sha":"x"}`)},
+	}}}
+	client := &http.Client{Transport: c.Replay()}
+	if _, err := client.Post("http://example.org/trees", "application/json", strings.NewReader(`{"a":2}`)); err == nil {
+		t.Error("replayed a request with a different body")
+	}
+	resp, err := client.Post("http://example.org/trees", "application/json", strings.NewReader(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, err := client.Post("http://example.org/trees", "application/json", strings.NewReader(`{"a":1}`)); err == nil {
+		t.Error("replayed the same exchange twice")
+	}
+}
+
+func TestBodyBinary(t *testing.T) {
+	c := &Cassette{Interactions: []*Interaction{{Response: RecordedResponse{Body: Body{0xff, 0xd8, 0x00}}}}}
+	path := filepath.Join(t.TempDir(), "bin.json")
+	if err := c.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Interactions[0].Response.Body; string(got) != "\xff\xd8\x00" {
+		t.Errorf("binary body = %x", got)
+	}
+}
@@ -0,0 +1,138 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// PlaylistFile is the content of a backed up playlist file.
+type PlaylistFile struct {
+	DefaultImg string `json:"defaultImg"`
+	// DefaultImgFile is the archived copy of DefaultImg.
+	DefaultImgFile string  `json:"defaultImgFile,omitempty"`
+	Videos         []Video `json:"videos"`
+	// Removed are the videos that dropped out of the playlist.
+	Removed []RemovedVideo `json:"removed,omitempty"`
+}
+
+// RemovedVideo is a video that dropped out of its playlist on Removed.
+type RemovedVideo struct {
+	Video
+	Removed string `json:"removed"`
+}
+
+// dateFormat is the layout of the firstSeen, lastSeen and removed dates.
+const dateFormat = "2006-01-02"
+
+// PlaylistChange lists how a playlist differs from its previous backup.
+type PlaylistChange struct {
+	Category string  `json:"category"`
+	Playlist string  `json:"playlist"`
+	Title    string  `json:"title"`
+	Added    []Video `json:"added,omitempty"`
+	Removed  []Video `json:"removed,omitempty"`
+	// Unavailable are the videos that became private or were deleted
+	// but are still listed.
+	Unavailable []Video `json:"unavailable,omitempty"`
+}
+
+// unavailableTitles are the placeholder titles YouTube gives to playlist
+// items whose video can no longer be watched.
+var unavailableTitles = map[string]bool{
+	"Private video": true,
+	"Deleted video": true,
+}
+
+// Unavailable reports whether v was made private or deleted.
+func (v Video) Unavailable() bool {
+	return unavailableTitles[v.Title]
+}
+
+// readBase returns the content of path in the base tree, nil when the path
+// is new.
+func (a *App) readBase(ctx context.Context, path string) ([]byte, error) {
+	if _, ok := a.head.Files[path]; !ok {
+		return nil, nil
+	}
+	return a.backend.ReadFile(ctx, a.head, path)
+}
+
+// readBasePlaylist parses the previous backup of a playlist file, nil when
+// there is none.
+func (a *App) readBasePlaylist(ctx context.Context, path string) (*PlaylistFile, error) {
+	content, err := a.readBase(ctx, path)
+	if err != nil || content == nil {
+		return nil, err
+	}
+	var f PlaylistFile
+	if err := json.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("invalid previous %s: %s", path, err)
+	}
+	return &f, nil
+}
+
+// trackSeen dates videos with the previous backup of their playlist:
+// videos keep their firstSeen, even when they come back after a removal,
+// while those that dropped out join the removed ones. Videos of backups
+// made before the dates were kept are first seen today.
+func trackSeen(previous *PlaylistFile, videos []Video, today string) []RemovedVideo {
+	current := map[string]bool{}
+	for _, v := range videos {
+		current[v.Id] = true
+	}
+	first := map[string]string{}
+	removed := []RemovedVideo{}
+	if previous != nil {
+		for _, r := range previous.Removed {
+			if current[r.Id] {
+				first[r.Id] = r.FirstSeen
+				continue
+			}
+			removed = append(removed, r)
+		}
+		for _, v := range previous.Videos {
+			if v.FirstSeen != "" {
+				first[v.Id] = v.FirstSeen
+			}
+			if !current[v.Id] {
+				removed = append(removed, RemovedVideo{Video: v, Removed: today})
+				// A duplicate entry must not be removed twice.
+				current[v.Id] = true
+			}
+		}
+	}
+	for i := range videos {
+		videos[i].FirstSeen = first[videos[i].Id]
+		if videos[i].FirstSeen == "" {
+			videos[i].FirstSeen = today
+		}
+		videos[i].LastSeen = today
+	}
+	return removed
+}
+
+// diffVideos compares the previous and current videos of a playlist.
+func diffVideos(previous, current []Video) (added, removed, unavailable []Video) {
+	before := map[string]Video{}
+	for _, v := range previous {
+		before[v.Id] = v
+	}
+	now := map[string]bool{}
+	for _, v := range current {
+		now[v.Id] = true
+		old, ok := before[v.Id]
+		switch {
+		case !ok:
+			added = append(added, v)
+		case v.Unavailable() && !old.Unavailable():
+			unavailable = append(unavailable, old)
+		}
+	}
+	for _, v := range previous {
+		if !now[v.Id] {
+			removed = append(removed, v)
+		}
+	}
+	return added, removed, unavailable
+}
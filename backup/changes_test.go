@@ -0,0 +1,168 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rwapps/video_gists/internal/fake"
+)
+
+func TestRunTracksSeenDates(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.Selection.Playlists = ParseList("PLrefugees")
+	run := func(day string, playlist []fake.Video) PlaylistFile {
+		t.Helper()
+		now, err := time.Parse(dateFormat, day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env.app.now = func() time.Time { return now.Add(12 * time.Hour) }
+		env.youtube.SetPlaylist("PLrefugees", playlist)
+		if err := env.app.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		var f PlaylistFile
+		files := env.github.Files(env.github.Head("master").SHA)
+		if err := json.Unmarshal([]byte(files["topic/Refugees-Migrants Emergency - Europe.json"]), &f); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	type dates struct{ id, first, last, removed string }
+	check := func(f PlaylistFile, videos, removed []dates) {
+		t.Helper()
+		var gotVideos, gotRemoved []dates
+		for _, v := range f.Videos {
+			gotVideos = append(gotVideos, dates{v.Id, v.FirstSeen, v.LastSeen, ""})
+		}
+		for _, r := range f.Removed {
+			gotRemoved = append(gotRemoved, dates{r.Id, r.FirstSeen, r.LastSeen, r.Removed})
+		}
+		if !reflect.DeepEqual(gotVideos, videos) {
+			t.Errorf("videos = %v, want %v", gotVideos, videos)
+		}
+		if !reflect.DeepEqual(gotRemoved, removed) {
+			t.Errorf("removed = %v, want %v", gotRemoved, removed)
+		}
+	}
+	a := fake.Video{Id: "a", Title: "A"}
+	b := fake.Video{Id: "b", Title: "B"}
+	c := fake.Video{Id: "c", Title: "C"}
+
+	f := run("2026-01-01", []fake.Video{a, b})
+	check(f, []dates{{"a", "2026-01-01", "2026-01-01", ""}, {"b", "2026-01-01", "2026-01-01", ""}}, nil)
+
+	f = run("2026-01-02", []fake.Video{a, c})
+	check(f,
+		[]dates{{"a", "2026-01-01", "2026-01-02", ""}, {"c", "2026-01-02", "2026-01-02", ""}},
+		[]dates{{"b", "2026-01-01", "2026-01-01", "2026-01-02"}})
+
+	// A video coming back keeps its first date and leaves the removed
+	// ones.
+	f = run("2026-01-05", []fake.Video{b, c})
+	check(f,
+		[]dates{{"b", "2026-01-01", "2026-01-05", ""}, {"c", "2026-01-02", "2026-01-05", ""}},
+		[]dates{{"a", "2026-01-01", "2026-01-02", "2026-01-05"}})
+
+	// Videos of an unchanged playlist are still seen.
+	f = run("2026-01-06", []fake.Video{b, c})
+	check(f,
+		[]dates{{"b", "2026-01-01", "2026-01-06", ""}, {"c", "2026-01-02", "2026-01-06", ""}},
+		[]dates{{"a", "2026-01-01", "2026-01-02", "2026-01-05"}})
+
+	// Another run of the day has nothing to commit.
+	head := env.github.Head("master").SHA
+	run("2026-01-06", []fake.Video{b, c})
+	if env.github.Head("master").SHA != head || env.app.LastRun.CommitResult != "empty" {
+		t.Errorf("a second run of the day committed: %s", env.app.LastRun.CommitResult)
+	}
+}
+
+func TestRunKeepsDatesOfRenamedPlaylist(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.now = func() time.Time { return time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC) }
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	files := env.github.Files(env.github.Head("master").SHA)
+	files["topic/Floods/flood0.en.vtt"] = "WEBVTT\n"
+	env.github.SetFiles("master", "captions", files)
+	env.reliefweb.SetFeed("topic", `[
+		{"title": "Floods and landslides", "id": "PLfloods"},
+		{"title": "Refugees/Migrants Emergency - Europe", "id": "PLrefugees"}
+	]`)
+	env.youtube.SetPlaylist("PLfloods", videos("flood", 6))
+	env.app.now = func() time.Time { return time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC) }
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var f PlaylistFile
+	files = env.github.Files(env.github.Head("master").SHA)
+	for _, path := range []string{"topic/Floods.json", "topic/Floods/flood0.en.vtt"} {
+		if _, ok := files[path]; ok {
+			t.Errorf("%s was kept after the rename", path)
+		}
+	}
+	if files["topic/Floods and landslides/flood0.en.vtt"] != "WEBVTT\n" {
+		t.Error("the captions were not moved")
+	}
+	if err := json.Unmarshal([]byte(files["topic/Floods and landslides.json"]), &f); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Videos) != 6 || f.Videos[0].FirstSeen != "2026-01-01" || f.Videos[0].LastSeen != "2026-01-02" {
+		t.Errorf("videos = %+v", f.Videos)
+	}
+	if len(f.Removed) != 1 || f.Removed[0].Id != "flood6" || f.Removed[0].Removed != "2026-01-02" {
+		t.Errorf("removed = %+v", f.Removed)
+	}
+}
+
+func TestBackendsDeleteRenamedPlaylist(t *testing.T) {
+	for _, backend := range []string{"gitlab", "gitea", "local"} {
+		env := newTestEnv(t)
+		var app *App
+		var files func() map[string]string
+		switch backend {
+		case "gitlab":
+			var gitlab *fake.GitLab
+			app, gitlab = newGitLabApp(t, env)
+			files = gitlab.Files
+		case "gitea":
+			var gitea *fake.Gitea
+			app, gitea = newGiteaApp(t, env)
+			files = gitea.Files
+		case "local":
+			dir := t.TempDir()
+			git(t, dir, "init", "--bare", "--initial-branch=master")
+			app = newLocalApp(t, env, dir)
+			files = func() map[string]string { return localFiles(t, dir) }
+		}
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		env.reliefweb.SetFeed("topic", `[{"title": "Floods and landslides", "id": "PLfloods"}]`)
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		after := files()
+		if _, ok := after["topic/Floods.json"]; ok {
+			t.Errorf("%s kept the file of the renamed playlist", backend)
+		}
+		readPlaylistFile(t, after, "topic/Floods and landslides.json")
+	}
+}
+
+func TestTrackSeenWithoutDates(t *testing.T) {
+	previous := &PlaylistFile{Videos: []Video{{Id: "a"}, {Id: "b"}, {Id: "b"}}}
+	videos := []Video{{Id: "a"}}
+	removed := trackSeen(previous, videos, "2026-03-01")
+	if videos[0].FirstSeen != "2026-03-01" || videos[0].LastSeen != "2026-03-01" {
+		t.Errorf("video = %+v", videos[0])
+	}
+	if len(removed) != 1 || removed[0].Id != "b" || removed[0].Removed != "2026-03-01" {
+		t.Errorf("removed = %+v", removed)
+	}
+}
@@ -0,0 +1,156 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Config contains the site configuration.
+type Config struct {
+	Categories []string `json:"Categories"`
+
+	// Backup repository, defaults to rwapps/video_backups on master.
+	Owner  string `json:"Owner,omitempty"`
+	Repo   string `json:"Repo,omitempty"`
+	Branch string `json:"Branch,omitempty"`
+	// Backend hosts the repository: "github" by default, "gitlab",
+	// "gitea" at GiteaURL, or "local" for the git repository at
+	// LocalRepo, bare or not, which needs no credentials.
+	Backend   string `json:"Backend,omitempty"`
+	LocalRepo string `json:"LocalRepo,omitempty"`
+
+	// API endpoints, only overridden for tests and mirrors.
+	YoutubeURL      string `json:"YoutubeURL,omitempty"`
+	ReliefwebURL    string `json:"ReliefwebURL,omitempty"`
+	GitHubURL       string `json:"GitHubURL,omitempty"`
+	GitHubUploadURL string `json:"GitHubUploadURL,omitempty"`
+	GitLabURL       string `json:"GitLabURL,omitempty"`
+	GiteaURL        string `json:"GiteaURL,omitempty"`
+
+	// Pagination limits for a single playlist.
+	MaxPages int `json:"MaxPages,omitempty"`
+	MaxItems int `json:"MaxItems,omitempty"`
+
+	// Daemon mode: a cron expression per category, the random delay
+	// added to each activation and how long shutdown waits for a run,
+	// both as Go durations.
+	Schedules     map[string]string `json:"Schedules,omitempty"`
+	Jitter        string            `json:"Jitter,omitempty"`
+	ShutdownGrace string            `json:"ShutdownGrace,omitempty"`
+
+	// Notifications are sent after each run.
+	Notifications []Notification `json:"Notifications,omitempty"`
+
+	// IssueAfter opens an issue in the backup repository once a playlist
+	// or feed failed that many runs in a row, 0 disables issues. They
+	// carry IssueLabel, "backup-failure" by default.
+	IssueAfter int    `json:"IssueAfter,omitempty"`
+	IssueLabel string `json:"IssueLabel,omitempty"`
+
+	// Thumbnails archives the playlist and video images under
+	// thumbnails/, skipping any larger than ThumbnailMaxBytes (1 MiB by
+	// default).
+	Thumbnails        bool  `json:"Thumbnails,omitempty"`
+	ThumbnailMaxBytes int64 `json:"ThumbnailMaxBytes,omitempty"`
+
+	// Captions archives the caption tracks of the videos in
+	// CaptionLanguages, every language when empty, spending at most
+	// CaptionQuota YouTube quota units a day (2000 by default, of the
+	// 10000 of a project). Downloads need YouTube OAuth for the channel
+	// owning the videos.
+	Captions         bool     `json:"Captions,omitempty"`
+	CaptionLanguages []string `json:"CaptionLanguages,omitempty"`
+	CaptionQuota     int      `json:"CaptionQuota,omitempty"`
+
+	// CacheDir keeps the YouTube and ReliefWeb responses to revalidate
+	// them with conditional requests, no cache when empty. Recorded and
+	// replayed runs go without it.
+	CacheDir string `json:"CacheDir,omitempty"`
+
+	// Sinks receive a copy of the files of every run.
+	Sinks []Sink `json:"Sinks,omitempty"`
+
+	// ArchiveDir, when set, receives an archive of the whole backup tree
+	// with a manifest after every run, in ArchiveFormat "tar.gz" (the
+	// default) or "zip". ArchiveRelease attaches it to the GitHub release
+	// tagged with the date.
+	ArchiveDir     string `json:"ArchiveDir,omitempty"`
+	ArchiveFormat  string `json:"ArchiveFormat,omitempty"`
+	ArchiveRelease bool   `json:"ArchiveRelease,omitempty"`
+
+	// ArchiveKeep, when set, deletes the archives in ArchiveDir and the
+	// releases dated before the last ArchiveKeep days, by default they
+	// are all kept. ArchiveDir/.blobs only ever holds the files of the
+	// last archive.
+	ArchiveKeep int `json:"ArchiveKeep,omitempty"`
+}
+
+// LoadConfig reads the configuration file at path.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("cannot read configuration file: %s", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("invalid configuration file: %s", err)
+	}
+	return config, nil
+}
+
+// setDefaults fills in the production values for anything left empty.
+func (c *Config) setDefaults() {
+	if c.Owner == "" {
+		c.Owner = "rwapps"
+	}
+	if c.Repo == "" {
+		c.Repo = "video_backups"
+	}
+	if c.Branch == "" {
+		c.Branch = "master"
+	}
+	if c.Backend == "" {
+		c.Backend = "github"
+	}
+	if c.YoutubeURL == "" {
+		c.YoutubeURL = "https://www.googleapis.com/youtube/v3"
+	}
+	if c.ReliefwebURL == "" {
+		c.ReliefwebURL = "http://reliefweb.int/sites/reliefweb.int/files/playlists"
+	}
+	if c.GitHubURL == "" {
+		c.GitHubURL = "https://api.github.com/"
+	}
+	if c.GitHubUploadURL == "" {
+		c.GitHubUploadURL = "https://uploads.github.com/"
+	}
+	if c.GitLabURL == "" {
+		c.GitLabURL = "https://gitlab.com/api/v4"
+	}
+	if c.IssueLabel == "" {
+		c.IssueLabel = "backup-failure"
+	}
+	if c.ThumbnailMaxBytes == 0 {
+		c.ThumbnailMaxBytes = 1 << 20
+	}
+	if c.CaptionQuota == 0 {
+		c.CaptionQuota = 2000
+	}
+	for i := range c.Sinks {
+		s := &c.Sinks[i]
+		if s.Region == "" {
+			s.Region = "us-east-1"
+		}
+		if s.Endpoint == "" {
+			s.Endpoint = "https://s3." + s.Region + ".amazonaws.com"
+		}
+	}
+	// YouTube caps playlists at 5000 items, 50 per page.
+	if c.MaxPages == 0 {
+		c.MaxPages = 100
+	}
+	if c.MaxItems == 0 {
+		c.MaxItems = 5000
+	}
+}
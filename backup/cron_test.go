@@ -0,0 +1,62 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2024, 2, 28, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@hourly", time.Date(2024, 2, 28, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90m", from.Add(90 * time.Minute)},
+		{"*/15 * * * *", time.Date(2024, 2, 28, 10, 45, 0, 0, time.UTC)},
+		// n/step runs from n to the end of the field.
+		{"5/15 * * * *", time.Date(2024, 2, 28, 10, 35, 0, 0, time.UTC)},
+		{"0 3/12 * * *", time.Date(2024, 2, 28, 15, 0, 0, 0, time.UTC)},
+		{"5 8-9,20 * * *", time.Date(2024, 2, 28, 20, 5, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// 2024-03-03 is a Sunday.
+		{"0 6 * * 7", time.Date(2024, 3, 3, 6, 0, 0, 0, time.UTC)},
+		// Either restricted day field matches: the 1st or a Friday.
+		{"0 0 1 * 5", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		// A stepped "*" is not a restriction, both day fields must match:
+		// an odd day that is a Friday, a 1st on Sunday, Tuesday, Thursday
+		// or Saturday.
+		{"0 0 */2 * 5", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * */2", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("%q: %s", tt.spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: next = %s, want %s", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every -1m", "@every soon", "@fortnightly"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestScheduleNever(t *testing.T) {
+	s, err := ParseSchedule("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Errorf("February 30th fired at %s", next)
+	}
+}
@@ -0,0 +1,180 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Daemon runs backups on the per category schedules of the config. Runs
+// never overlap: categories falling due while a run is in progress are
+// queued and backed up together once it finishes.
+type Daemon struct {
+	App *App
+	// Schedules maps each category to its schedule.
+	Schedules map[string]Schedule
+	// Jitter delays each activation by a random duration below it.
+	Jitter time.Duration
+	// Grace is how long shutdown waits for the current run before
+	// cancelling it, a cancelled run commits what it has so far.
+	Grace time.Duration
+
+	now func() time.Time
+	// run backs up categories, it is App.RunCategories outside of tests.
+	run func(ctx context.Context, categories []string) error
+
+	mu      sync.Mutex
+	pending map[string]bool
+	wake    chan struct{}
+}
+
+// NewDaemon builds a Daemon from app.Config.Schedules. Categories without
+// a schedule are not backed up by the daemon.
+func NewDaemon(app *App) (*Daemon, error) {
+	d := &Daemon{
+		App:       app,
+		Schedules: map[string]Schedule{},
+		Grace:     5 * time.Minute,
+		now:       time.Now,
+		run:       app.RunCategories,
+		pending:   map[string]bool{},
+		wake:      make(chan struct{}, 1),
+	}
+	for category, spec := range app.Config.Schedules {
+		s, err := ParseSchedule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("schedule for %s: %s", category, err)
+		}
+		if s.Next(d.now()).IsZero() {
+			return nil, fmt.Errorf("schedule for %s: %q never fires", category, spec)
+		}
+		d.Schedules[category] = s
+	}
+	if len(d.Schedules) == 0 {
+		return nil, fmt.Errorf("no schedules configured")
+	}
+	var err error
+	if app.Config.Jitter != "" {
+		if d.Jitter, err = time.ParseDuration(app.Config.Jitter); err != nil {
+			return nil, fmt.Errorf("invalid Jitter: %s", err)
+		}
+	}
+	if app.Config.ShutdownGrace != "" {
+		if d.Grace, err = time.ParseDuration(app.Config.ShutdownGrace); err != nil {
+			return nil, fmt.Errorf("invalid ShutdownGrace: %s", err)
+		}
+	}
+	return d, nil
+}
+
+// jitter returns a random delay below d.Jitter.
+func (d *Daemon) jitter() time.Duration {
+	if d.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d.Jitter)))
+}
+
+// Serve schedules runs until ctx is done, then waits up to Grace for the
+// current run before cancelling it.
+func (d *Daemon) Serve(ctx context.Context) error {
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.worker(runCtx)
+	}()
+
+	for category, s := range d.Schedules {
+		go d.schedule(ctx, category, s)
+	}
+
+	<-ctx.Done()
+	log.Println("shutting down, waiting for the current run")
+	cancelWorker := time.AfterFunc(d.Grace, func() {
+		log.Println("grace period over, checkpointing the current run")
+		cancelRun()
+	})
+	defer cancelWorker.Stop()
+	// Stops the worker once the current run returns.
+	d.stop()
+	<-done
+	return nil
+}
+
+// schedule queues category each time s fires.
+func (d *Daemon) schedule(ctx context.Context, category string, s Schedule) {
+	next := s.Next(d.now())
+	for {
+		at := next.Add(d.jitter())
+		timer := time.NewTimer(at.Sub(d.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		d.enqueue(category)
+		now := d.now()
+		if next = s.Next(next); next.Before(now) {
+			// The machine slept or a run was long, skip missed slots.
+			next = s.Next(now)
+		}
+	}
+}
+
+func (d *Daemon) enqueue(category string) {
+	d.mu.Lock()
+	if d.pending != nil {
+		d.pending[category] = true
+	}
+	d.mu.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop tells the worker to exit after the current run.
+func (d *Daemon) stop() {
+	d.mu.Lock()
+	d.pending = nil
+	d.mu.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// worker runs the queued categories one batch at a time.
+func (d *Daemon) worker(ctx context.Context) {
+	for range d.wake {
+		d.mu.Lock()
+		if d.pending == nil {
+			d.mu.Unlock()
+			return
+		}
+		var categories []string
+		for c := range d.pending {
+			categories = append(categories, c)
+		}
+		d.pending = map[string]bool{}
+		d.mu.Unlock()
+		if len(categories) == 0 {
+			continue
+		}
+		sort.Strings(categories)
+		log.Printf("scheduled run of %v\n", categories)
+		if err := d.run(ctx, categories); err != nil {
+			log.Printf("run of %v failed: %s\n", categories, err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
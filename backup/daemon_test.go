@@ -0,0 +1,109 @@
+package backup
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestDaemon(t *testing.T, schedules map[string]string) *Daemon {
+	env := newTestEnv(t)
+	env.app.Config.Schedules = schedules
+	d, err := NewDaemon(env.app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestDaemonRunsDoNotOverlap(t *testing.T) {
+	d := newTestDaemon(t, map[string]string{
+		"topic":        "@every 5ms",
+		"organization": "@every 7ms",
+	})
+	var mu sync.Mutex
+	running, overlaps := 0, 0
+	runs := map[string]int{}
+	d.run = func(ctx context.Context, categories []string) error {
+		mu.Lock()
+		running++
+		if running > 1 {
+			overlaps++
+		}
+		for _, c := range categories {
+			runs[c]++
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	if err := d.Serve(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if overlaps != 0 {
+		t.Errorf("%d runs overlapped", overlaps)
+	}
+	if runs["topic"] == 0 || runs["organization"] == 0 {
+		t.Errorf("runs = %v, want both categories", runs)
+	}
+	if running != 0 {
+		t.Error("Serve returned with a run in progress")
+	}
+}
+
+func TestDaemonShutdownGrace(t *testing.T) {
+	d := newTestDaemon(t, map[string]string{"topic": "@every 1ms"})
+	d.Grace = 10 * time.Millisecond
+	started := make(chan struct{})
+	var once sync.Once
+	var runErr error
+	d.run = func(ctx context.Context, categories []string) error {
+		once.Do(func() { close(started) })
+		// A run that only stops when cancelled.
+		<-ctx.Done()
+		runErr = ctx.Err()
+		return runErr
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	done := make(chan error)
+	go func() { done <- d.Serve(ctx) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not cancel the run after the grace period")
+	}
+	if runErr != context.Canceled {
+		t.Errorf("run ended with %v, want context.Canceled", runErr)
+	}
+}
+
+func TestNewDaemonInvalid(t *testing.T) {
+	env := newTestEnv(t)
+	for _, schedules := range []map[string]string{
+		nil,
+		{"topic": "every hour"},
+		{"topic": "0 0 31 4 *"},
+	} {
+		env.app.Config.Schedules = schedules
+		if _, err := NewDaemon(env.app); err == nil {
+			t.Errorf("%v: expected an error", schedules)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SnapshotDiff compares the backups of two commits.
+type SnapshotDiff struct {
+	From       DiffPoint      `json:"from"`
+	To         DiffPoint      `json:"to"`
+	Categories []CategoryDiff `json:"categories"`
+}
+
+// DiffPoint is a side of a diff.
+type DiffPoint struct {
+	Commit string    `json:"commit"`
+	Date   time.Time `json:"date"`
+}
+
+// CategoryDiff lists the playlists a category gained, lost or renamed
+// and the membership changes of those it kept.
+type CategoryDiff struct {
+	Name    string           `json:"name"`
+	Added   []DiffPlaylist   `json:"added,omitempty"`
+	Removed []DiffPlaylist   `json:"removed,omitempty"`
+	Renamed []PlaylistRename `json:"renamed,omitempty"`
+	Changes []PlaylistChange `json:"changes,omitempty"`
+}
+
+// DiffPlaylist is a playlist added or removed, with its number of videos.
+type DiffPlaylist struct {
+	Id     string `json:"id"`
+	Title  string `json:"title"`
+	Videos int    `json:"videos"`
+}
+
+// PlaylistRename is a playlist whose title changed in the feed.
+type PlaylistRename struct {
+	Id   string `json:"id"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (c CategoryDiff) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Renamed) == 0 && len(c.Changes) == 0
+}
+
+// Diff compares the backups at from and to, each a commit or a date, for
+// the selected categories. Playlists are matched by id through the feeds
+// so a new title is a rename.
+func (a *App) Diff(ctx context.Context, from, to string) (*SnapshotDiff, error) {
+	b, err := a.historyBackend()
+	if err != nil {
+		return nil, err
+	}
+	d := &SnapshotDiff{Categories: []CategoryDiff{}}
+	var snapshots [2]*Snapshot
+	for i, at := range []string{from, to} {
+		c, err := b.commitAt(ctx, at)
+		if err != nil {
+			return nil, err
+		}
+		if snapshots[i], err = b.snapshot(ctx, c.GetSHA()); err != nil {
+			return nil, err
+		}
+		point := DiffPoint{Commit: c.GetSHA(), Date: commitDate(c)}
+		if i == 0 {
+			d.From = point
+		} else {
+			d.To = point
+		}
+	}
+	for _, category := range a.Config.Categories {
+		if !a.Selection.includesCategory(category) {
+			continue
+		}
+		cd, err := diffCategory(ctx, b, category, snapshots[0], snapshots[1])
+		if err != nil {
+			return nil, err
+		}
+		if cd != nil {
+			d.Categories = append(d.Categories, *cd)
+		}
+	}
+	return d, nil
+}
+
+// diffCategory compares a category in two snapshots, nil when neither
+// has its feed.
+func diffCategory(ctx context.Context, b Backend, category string, from, to *Snapshot) (*CategoryDiff, error) {
+	before, okBefore, err := readFeed(ctx, b, from, category)
+	if err != nil {
+		return nil, err
+	}
+	after, okAfter, err := readFeed(ctx, b, to, category)
+	if err != nil {
+		return nil, err
+	}
+	if !okBefore && !okAfter {
+		return nil, nil
+	}
+	cd := &CategoryDiff{Name: category}
+	old := map[string]Playlist{}
+	for _, p := range before {
+		old[p.Id] = p
+	}
+	kept := map[string]bool{}
+	for _, p := range after {
+		previous, ok := old[p.Id]
+		if !ok {
+			cd.Added = append(cd.Added, DiffPlaylist{Id: p.Id, Title: p.Title, Videos: countVideos(ctx, b, to, playlistPath(category, p.Title))})
+			continue
+		}
+		kept[p.Id] = true
+		if previous.Title != p.Title {
+			cd.Renamed = append(cd.Renamed, PlaylistRename{Id: p.Id, From: previous.Title, To: p.Title})
+		}
+		change, err := diffPlaylist(ctx, b, from, to, playlistPath(category, previous.Title), playlistPath(category, p.Title))
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			change.Category, change.Playlist, change.Title = category, p.Id, p.Title
+			cd.Changes = append(cd.Changes, *change)
+		}
+	}
+	for _, p := range before {
+		if !kept[p.Id] {
+			cd.Removed = append(cd.Removed, DiffPlaylist{Id: p.Id, Title: p.Title, Videos: countVideos(ctx, b, from, playlistPath(category, p.Title))})
+		}
+	}
+	return cd, nil
+}
+
+// readFeed parses the archived feed of category in s.
+func readFeed(ctx context.Context, b Backend, s *Snapshot, category string) ([]Playlist, bool, error) {
+	path := fmt.Sprintf("%s/playlist.json", category)
+	if _, ok := s.Files[path]; !ok {
+		return nil, false, nil
+	}
+	content, err := b.ReadFile(ctx, s, path)
+	if err != nil {
+		return nil, false, err
+	}
+	playlists, err := preparePlaylists(category, content)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid archived %s at %s: %s", path, s.Commit, err)
+	}
+	return playlists, true, nil
+}
+
+// readPlaylist parses the playlist file at path in s, nil when missing.
+func readPlaylist(ctx context.Context, b Backend, s *Snapshot, path string) (*PlaylistFile, error) {
+	if _, ok := s.Files[path]; !ok {
+		return nil, nil
+	}
+	content, err := b.ReadFile(ctx, s, path)
+	if err != nil {
+		return nil, err
+	}
+	var f PlaylistFile
+	if err := json.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("invalid %s at %s: %s", path, s.Commit, err)
+	}
+	return &f, nil
+}
+
+// countVideos counts the videos of a playlist file, 0 when unreadable.
+func countVideos(ctx context.Context, b Backend, s *Snapshot, path string) int {
+	f, err := readPlaylist(ctx, b, s, path)
+	if err != nil || f == nil {
+		return 0
+	}
+	return len(f.Videos)
+}
+
+// diffPlaylist compares the videos of a playlist file, nil when its
+// membership is unchanged or one side has no file.
+func diffPlaylist(ctx context.Context, b Backend, from, to *Snapshot, fromPath, toPath string) (*PlaylistChange, error) {
+	if from.Files[fromPath] == to.Files[toPath] {
+		return nil, nil
+	}
+	before, err := readPlaylist(ctx, b, from, fromPath)
+	if err != nil || before == nil {
+		return nil, err
+	}
+	after, err := readPlaylist(ctx, b, to, toPath)
+	if err != nil || after == nil {
+		return nil, err
+	}
+	c := &PlaylistChange{}
+	c.Added, c.Removed, c.Unavailable = diffVideos(before.Videos, after.Videos)
+	if len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Unavailable) == 0 {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// WriteText writes the diff for a terminal.
+func (d *SnapshotDiff) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "backup %.7s (%s) to %.7s (%s)\n", d.From.Commit, d.From.Date.Format(time.RFC3339), d.To.Commit, d.To.Date.Format(time.RFC3339))
+	for _, c := range d.Categories {
+		fmt.Fprintf(w, "\n%s\n", c.Name)
+		if c.empty() {
+			fmt.Fprintln(w, "  no changes")
+		}
+		for _, p := range c.Added {
+			fmt.Fprintf(w, "  playlist added: %s (%s, %d videos)\n", p.Title, p.Id, p.Videos)
+		}
+		for _, p := range c.Removed {
+			fmt.Fprintf(w, "  playlist removed: %s (%s, %d videos)\n", p.Title, p.Id, p.Videos)
+		}
+		for _, r := range c.Renamed {
+			fmt.Fprintf(w, "  playlist renamed: %s -> %s (%s)\n", r.From, r.To, r.Id)
+		}
+		for _, ch := range c.Changes {
+			fmt.Fprintf(w, "  %s: +%d -%d\n", ch.Title, len(ch.Added), len(ch.Removed))
+			for _, v := range ch.Added {
+				fmt.Fprintf(w, "    + %s %s\n", v.Id, v.Title)
+			}
+			for _, v := range ch.Removed {
+				fmt.Fprintf(w, "    - %s %s\n", v.Id, v.Title)
+			}
+			for _, v := range ch.Unavailable {
+				fmt.Fprintf(w, "    ! %s %s is no longer available\n", v.Id, v.Title)
+			}
+		}
+	}
+}
+
+// WriteMarkdown writes the diff for editorial reports.
+func (d *SnapshotDiff) WriteMarkdown(w io.Writer) {
+	fmt.Fprintf(w, "# Video backup changes from %s to %s\n\n", d.From.Date.Format(dateFormat), d.To.Date.Format(dateFormat))
+	fmt.Fprintf(w, "Backup commits `%.7s` to `%.7s`.\n", d.From.Commit, d.To.Commit)
+	for _, c := range d.Categories {
+		fmt.Fprintf(w, "\n## %s\n\n", c.Name)
+		if c.empty() {
+			fmt.Fprintln(w, "_No changes._")
+			continue
+		}
+		for _, p := range c.Added {
+			fmt.Fprintf(w, "- Playlist added: **%s** (`%s`, %d videos)\n", p.Title, p.Id, p.Videos)
+		}
+		for _, p := range c.Removed {
+			fmt.Fprintf(w, "- Playlist removed: **%s** (`%s`, %d videos)\n", p.Title, p.Id, p.Videos)
+		}
+		for _, r := range c.Renamed {
+			fmt.Fprintf(w, "- Playlist renamed: **%s** → **%s** (`%s`)\n", r.From, r.To, r.Id)
+		}
+		for _, ch := range c.Changes {
+			fmt.Fprintf(w, "\n### %s\n\n", ch.Title)
+			for _, v := range ch.Added {
+				fmt.Fprintf(w, "- Added: %s (`%s`)\n", v.Title, v.Id)
+			}
+			for _, v := range ch.Removed {
+				fmt.Fprintf(w, "- Removed: %s (`%s`)\n", v.Title, v.Id)
+			}
+			for _, v := range ch.Unavailable {
+				fmt.Fprintf(w, "- No longer available: %s (`%s`)\n", v.Title, v.Id)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// diffEnv backs up twice, the second time with the floods playlist
+// shrunk, the refugees one renamed and a new earthquakes playlist.
+func diffEnv(t *testing.T) (*testEnv, string, string) {
+	env := newTestEnv(t)
+	env.github.Now = func() time.Time { return time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC) }
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	from := env.app.LastRun.Commit
+
+	env.github.Now = func() time.Time { return time.Date(2025, 4, 1, 10, 0, 0, 0, time.UTC) }
+	floods := videos("flood", 7)[1:]
+	floods[0].Title = "Private video"
+	env.youtube.SetPlaylist("PLfloods", append(floods, videos("flood", 9)[7:]...))
+	env.youtube.SetPlaylist("PLquakes", videos("quake", 2))
+	env.reliefweb.SetFeed("topic", `[
+		{"title": "Floods", "id": "PLfloods"},
+		{"title": "Europe migration", "id": "PLrefugees"},
+		{"title": "Earthquakes", "id": "PLquakes"}
+	]`)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return env, from, env.app.LastRun.Commit
+}
+
+func TestDiff(t *testing.T) {
+	env, from, to := diffEnv(t)
+	d, err := env.app.Diff(context.Background(), "2025-03-15", to[:7])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.From.Commit != from || d.To.Commit != to || len(d.Categories) != 2 {
+		t.Fatalf("diff = %+v", d)
+	}
+	topic := d.Categories[0]
+	if len(topic.Added) != 1 || topic.Added[0] != (DiffPlaylist{Id: "PLquakes", Title: "Earthquakes", Videos: 2}) {
+		t.Errorf("added = %+v", topic.Added)
+	}
+	if len(topic.Removed) != 0 {
+		t.Errorf("removed = %+v", topic.Removed)
+	}
+	if len(topic.Renamed) != 1 || topic.Renamed[0] != (PlaylistRename{Id: "PLrefugees", From: "Refugees/Migrants Emergency - Europe", To: "Europe migration"}) {
+		t.Errorf("renamed = %+v", topic.Renamed)
+	}
+	if len(topic.Changes) != 1 {
+		t.Fatalf("changes = %+v", topic.Changes)
+	}
+	c := topic.Changes[0]
+	if c.Playlist != "PLfloods" || ids(c.Added) != "flood7,flood8" || ids(c.Removed) != "flood0" || ids(c.Unavailable) != "flood1" {
+		t.Errorf("floods change = %+v", c)
+	}
+	if org := d.Categories[1]; !org.empty() {
+		t.Errorf("organization = %+v", org)
+	}
+
+	var text, md bytes.Buffer
+	d.WriteText(&text)
+	d.WriteMarkdown(&md)
+	for _, want := range []string{
+		"playlist added: Earthquakes (PLquakes, 2 videos)",
+		"playlist renamed: Refugees/Migrants Emergency - Europe -> Europe migration (PLrefugees)",
+		"    + flood7 flood video 7",
+		"    - flood0 flood video 0",
+		"    ! flood1 flood video 1 is no longer available",
+		"organization\n  no changes",
+	} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text lacks %q:\n%s", want, text.String())
+		}
+	}
+	for _, want := range []string{
+		"# Video backup changes from 2025-03-01 to 2025-04-01",
+		"## topic",
+		"- Playlist renamed: **Refugees/Migrants Emergency - Europe** → **Europe migration** (`PLrefugees`)",
+		"### Floods\n\n- Added: flood video 7 (`flood7`)",
+		"- No longer available: flood video 1 (`flood1`)",
+		"## organization\n\n_No changes._",
+	} {
+		if !strings.Contains(md.String(), want) {
+			t.Errorf("markdown lacks %q:\n%s", want, md.String())
+		}
+	}
+}
+
+func TestDiffSelection(t *testing.T) {
+	env, from, to := diffEnv(t)
+	env.app.Selection.Categories = ParseList("organization")
+	d, err := env.app.Diff(context.Background(), from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Categories) != 1 || d.Categories[0].Name != "organization" {
+		t.Errorf("categories = %+v", d.Categories)
+	}
+}
@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// ExportResult describes a point in time export.
+type ExportResult struct {
+	Commit string    `json:"commit"`
+	Date   time.Time `json:"date"`
+	Files  int       `json:"files"`
+}
+
+// ParseAt reads the date of a --at flag, a day meaning its end in UTC.
+// It returns false for anything else, which is taken as a commit.
+func ParseAt(at string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, at); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(dateFormat, at); err == nil {
+		return t.Add(24*time.Hour - time.Second), true
+	}
+	return time.Time{}, false
+}
+
+// historyBackend returns the GitHub backend the history commands walk
+// through the Git Data API.
+func (a *App) historyBackend() (*githubBackend, error) {
+	b, ok := a.backend.(*githubBackend)
+	if !ok {
+		return nil, fmt.Errorf("the backup history needs the github backend, not %s", a.Config.Backend)
+	}
+	return b, nil
+}
+
+// commitAt finds the commit of the branch in effect at a date, or the
+// commit named by at.
+func (b *githubBackend) commitAt(ctx context.Context, at string) (*github.RepositoryCommit, error) {
+	t, ok := ParseAt(at)
+	if !ok {
+		c, _, err := b.client.Repositories.GetCommit(ctx, b.owner, b.repo, at)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find commit %s: %s", at, err)
+		}
+		return c, nil
+	}
+	commits, _, err := b.client.Repositories.ListCommits(ctx, b.owner, b.repo, &github.CommitsListOptions{
+		SHA:         b.branch,
+		Until:       t,
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list the commits until %s: %s", t.Format(time.RFC3339), err)
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("no backup was made before %s", t.Format(time.RFC3339))
+	}
+	return commits[0], nil
+}
+
+// commitDate is when c was committed.
+func commitDate(c *github.RepositoryCommit) time.Time {
+	if c.Commit != nil && c.Commit.Committer != nil {
+		return c.Commit.Committer.GetDate()
+	}
+	return time.Time{}
+}
+
+// includesPath reports whether the file at path belongs to the selected
+// categories and playlists, the latter matched by title against the
+// playlist files and the directories of their captions.
+func (s Selection) includesPath(path string) bool {
+	if len(s.Categories) == 0 && len(s.Playlists) == 0 {
+		return true
+	}
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) < 2 || !s.includesCategory(parts[0]) {
+		return false
+	}
+	return len(s.Playlists) == 0 || s.Playlists[strings.TrimSuffix(parts[1], ".json")]
+}
+
+// ExportAt writes the files of the backup as they were at, a commit or a
+// date, below dir. Only the selected files are written, everything when
+// nothing is selected.
+func (a *App) ExportAt(ctx context.Context, at, dir string) (*ExportResult, error) {
+	b, err := a.historyBackend()
+	if err != nil {
+		return nil, err
+	}
+	c, err := b.commitAt(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	s, err := b.snapshot(ctx, c.GetSHA())
+	if err != nil {
+		return nil, err
+	}
+	result := &ExportResult{Commit: s.Commit, Date: commitDate(c)}
+	root := filepath.Clean(dir)
+	for path := range s.Files {
+		if !a.Selection.includesPath(path) {
+			continue
+		}
+		target := filepath.Join(root, filepath.FromSlash(path))
+		if !strings.HasPrefix(target, root+string(filepath.Separator)) {
+			return nil, fmt.Errorf("refusing to write %s outside %s", path, dir)
+		}
+		content, err := b.ReadFile(ctx, s, path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %s", path, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(target, content, 0644); err != nil {
+			return nil, err
+		}
+		result.Files++
+	}
+	if result.Files == 0 {
+		return nil, fmt.Errorf("commit %s holds no selected file", s.Commit)
+	}
+	return result, nil
+}
@@ -0,0 +1,95 @@
+package backup
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAt(t *testing.T) {
+	for _, tt := range []struct {
+		at   string
+		want time.Time
+		ok   bool
+	}{
+		{"2025-03-01", time.Date(2025, 3, 1, 23, 59, 59, 0, time.UTC), true},
+		{"2025-03-01T12:00:00Z", time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), true},
+		{"a1b2c3d", time.Time{}, false},
+	} {
+		got, ok := ParseAt(tt.at)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("ParseAt(%q) = %s, %v", tt.at, got, ok)
+		}
+	}
+}
+
+// historyEnv commits three versions of the floods playlist on the first
+// days of March 2025.
+func historyEnv(t *testing.T) (*testEnv, []string) {
+	env := newTestEnv(t)
+	var commits []string
+	for day, n := range []int{3, 5, 4} {
+		env.github.Now = func() time.Time { return time.Date(2025, 3, day+1, 10, 0, 0, 0, time.UTC) }
+		env.youtube.SetPlaylist("PLfloods", videos("flood", n))
+		if err := env.app.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		commits = append(commits, env.app.LastRun.Commit)
+	}
+	return env, commits
+}
+
+// readExported reads a file written by an export.
+func readExported(t *testing.T, dir, path string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestExportAtDate(t *testing.T) {
+	env, commits := historyEnv(t)
+	dir := t.TempDir()
+	result, err := env.app.ExportAt(context.Background(), "2025-03-02", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Commit != commits[1] || !result.Date.Equal(time.Date(2025, 3, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("exported %+v, want %s", result, commits[1])
+	}
+	files := env.github.Files(commits[1])
+	if result.Files != len(files) {
+		t.Errorf("exported %d files, want %d", result.Files, len(files))
+	}
+	if got := readExported(t, dir, "topic/Floods.json"); got != files["topic/Floods.json"] {
+		t.Errorf("topic/Floods.json = %s", got)
+	}
+
+	if _, err := env.app.ExportAt(context.Background(), "2025-02-28", t.TempDir()); err == nil || !strings.Contains(err.Error(), "no backup") {
+		t.Errorf("export before the first backup: %v", err)
+	}
+}
+
+func TestExportAtCommitSelection(t *testing.T) {
+	env, commits := historyEnv(t)
+	dir := t.TempDir()
+	env.app.Selection = Selection{Categories: ParseList("topic"), Playlists: ParseList("Floods")}
+	result, err := env.app.ExportAt(context.Background(), commits[0][:7], dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Commit != commits[0] || result.Files != 1 {
+		t.Errorf("exported %+v", result)
+	}
+	if got := readExported(t, dir, "topic/Floods.json"); got != env.github.Files(commits[0])["topic/Floods.json"] {
+		t.Errorf("topic/Floods.json = %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "README.md")); err == nil {
+		t.Error("unselected README.md exported")
+	}
+}
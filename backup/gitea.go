@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// giteaBackend commits through the Gitea contents API, which changes
+// several files in one commit.
+type giteaBackend struct {
+	http *http.Client
+	// base is the API root, https://gitea.example.org/api/v1.
+	base, owner, repo, branch string
+}
+
+// giteaFile is a file operation of a Gitea commit.
+type giteaFile struct {
+	Operation string `json:"operation"`
+	Path      string `json:"path"`
+	Content   string `json:"content,omitempty"`
+	// SHA is the blob being replaced, Gitea refuses the update when the
+	// file changed since.
+	SHA string `json:"sha,omitempty"`
+}
+
+func (b *giteaBackend) repoURL(path string) string {
+	u := fmt.Sprintf("%s/repos/%s/%s", b.base, url.PathEscape(b.owner), url.PathEscape(b.repo))
+	if path != "" {
+		u += "/" + path
+	}
+	return u
+}
+
+func (b *giteaBackend) Head(ctx context.Context) (*Snapshot, error) {
+	var branch struct {
+		Commit struct {
+			Id string `json:"id"`
+		} `json:"commit"`
+	}
+	if _, _, err := apiRequest(ctx, b.http, "GET", b.repoURL("branches/"+url.PathEscape(b.branch)), nil, &branch); err != nil {
+		return nil, fmt.Errorf("gitea branch error: %s", err)
+	}
+	s := &Snapshot{Commit: branch.Commit.Id, Files: map[string]string{}}
+	// Large trees come in pages, total_count counts every entry.
+	seen := 0
+	for page := 1; ; page++ {
+		q := url.Values{}
+		q.Set("recursive", "true")
+		q.Set("per_page", "1000")
+		q.Set("page", strconv.Itoa(page))
+		var tree struct {
+			SHA        string `json:"sha"`
+			TotalCount int    `json:"total_count"`
+			Tree       []struct {
+				Path string `json:"path"`
+				Type string `json:"type"`
+				SHA  string `json:"sha"`
+			} `json:"tree"`
+		}
+		if _, _, err := apiRequest(ctx, b.http, "GET", b.repoURL("git/trees/"+s.Commit+"?"+q.Encode()), nil, &tree); err != nil {
+			return nil, fmt.Errorf("gitea tree error: %s", err)
+		}
+		s.Tree = tree.SHA
+		for _, e := range tree.Tree {
+			if e.Type == "blob" {
+				s.Files[e.Path] = e.SHA
+			}
+		}
+		seen += len(tree.Tree)
+		if len(tree.Tree) == 0 || seen >= tree.TotalCount {
+			return s, nil
+		}
+	}
+}
+
+func (b *giteaBackend) ReadFile(ctx context.Context, s *Snapshot, path string) ([]byte, error) {
+	var blob struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if _, _, err := apiRequest(ctx, b.http, "GET", b.repoURL("git/blobs/"+s.Files[path]), nil, &blob); err != nil {
+		return nil, fmt.Errorf("gitea blob error: %s", err)
+	}
+	if blob.Encoding != "base64" {
+		return []byte(blob.Content), nil
+	}
+	return base64.StdEncoding.DecodeString(blob.Content)
+}
+
+// Commit changes the files in one commit, updating or deleting those in
+// base with their blob SHA and creating the others.
+func (b *giteaBackend) Commit(ctx context.Context, base *Snapshot, message string, changes []Change) (string, error) {
+	changes = changed(base, changes)
+	if len(changes) == 0 {
+		return base.Commit, nil
+	}
+	var files []giteaFile
+	for _, c := range changes {
+		if c.Delete {
+			files = append(files, giteaFile{Operation: "delete", Path: c.Path, SHA: base.Files[c.Path]})
+			continue
+		}
+		f := giteaFile{Operation: "create", Path: c.Path, Content: base64.StdEncoding.EncodeToString(c.Content)}
+		if sha, ok := base.Files[c.Path]; ok {
+			f.Operation, f.SHA = "update", sha
+		}
+		files = append(files, f)
+	}
+	input := map[string]interface{}{
+		"branch":  b.branch,
+		"message": message,
+		"files":   files,
+	}
+	var result struct {
+		Commit struct {
+			SHA string `json:"sha"`
+		} `json:"commit"`
+	}
+	if _, _, err := apiRequest(ctx, b.http, "POST", b.repoURL("contents"), input, &result); err != nil {
+		if hasStatus(err, http.StatusConflict) || hasStatus(err, http.StatusUnprocessableEntity) {
+			return "", staleHead(base, err)
+		}
+		return "", fmt.Errorf("gitea commit error: %s", err)
+	}
+	return result.Commit.SHA, nil
+}
+
+func (b *giteaBackend) Check(ctx context.Context) (string, error) {
+	var repo struct {
+		Permissions struct {
+			Admin bool `json:"admin"`
+			Push  bool `json:"push"`
+		} `json:"permissions"`
+	}
+	if _, _, err := apiRequest(ctx, b.http, "GET", b.repoURL(""), nil, &repo); err != nil {
+		return "", fmt.Errorf("cannot read repository %s/%s: %s", b.owner, b.repo, err)
+	}
+	if !repo.Permissions.Push && !repo.Permissions.Admin {
+		return "", fmt.Errorf("no push permission on %s/%s", b.owner, b.repo)
+	}
+	return fmt.Sprintf("can push to %s/%s", b.owner, b.repo), nil
+}
@@ -0,0 +1,97 @@
+package backup
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rwapps/video_gists/internal/fake"
+)
+
+// newGiteaApp backs up the fakes of env to a Gitea fake.
+func newGiteaApp(t *testing.T, env *testEnv) (*App, *fake.Gitea) {
+	gitea := fake.NewGitea("rwapps", "video_backups", "master", map[string]string{"README.md": "video backups\n"})
+	gitea.Token = "gitea-token"
+	gitea.PageSize = 3
+	t.Cleanup(gitea.Close)
+	config := env.app.Config
+	config.Backend = "gitea"
+	config.GiteaURL = gitea.URL + "/api/v1"
+	app, err := NewApp(config, nil, &http.Client{Transport: &bearer{"gitea-token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.YoutubeAPIKey = "test-key"
+	return app, gitea
+}
+
+func TestGiteaBackendRun(t *testing.T) {
+	env := newTestEnv(t)
+	app, gitea := newGiteaApp(t, env)
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	head := gitea.Head()
+	if head.Message != "updating playlists" || app.LastRun.Commit != head.SHA {
+		t.Fatalf("head = %+v after %+v", head, app.LastRun)
+	}
+	files := gitea.Files()
+	readPlaylistFile(t, files, "topic/Floods.json")
+	readPlaylistFile(t, files, "topic/Refugees-Migrants Emergency - Europe.json")
+	if files["README.md"] != "video backups\n" {
+		t.Error("README.md was lost")
+	}
+
+	env.youtube.SetPlaylist("PLfloods", videos("flood", 2))
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if floods := readPlaylistFile(t, gitea.Files(), "topic/Floods.json"); len(floods.Videos) != 2 {
+		t.Errorf("floods playlist = %+v", floods)
+	}
+	if len(gitea.Head().Parents) != 1 || gitea.Head().Parents[0] != head.SHA {
+		t.Errorf("second commit = %+v, want a child of %s", gitea.Head(), head.SHA)
+	}
+}
+
+func TestGiteaBackendCommitConflict(t *testing.T) {
+	env := newTestEnv(t)
+	app, gitea := newGiteaApp(t, env)
+	ctx := context.Background()
+	base, err := app.backend.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := app.backend.ReadFile(ctx, base, "README.md")
+	if err != nil || string(content) != "video backups\n" {
+		t.Fatalf("read %q, %v", content, err)
+	}
+	gitea.SetFiles("concurrent", map[string]string{"README.md": "changed\n"})
+	_, err = app.backend.Commit(ctx, base, "test", []Change{{Path: "README.md", Content: []byte("mine\n")}})
+	if err == nil || !strings.Contains(err.Error(), "409") || !strings.Contains(err.Error(), "moved since") {
+		t.Errorf("update of a changed file: %v", err)
+	}
+}
+
+func TestGiteaBackendCheck(t *testing.T) {
+	env := newTestEnv(t)
+	app, gitea := newGiteaApp(t, env)
+	gitea.Push = false
+	c := checksByName(app.Preflight(context.Background()))["gitea"]
+	if c.OK || !strings.Contains(c.Detail, "no push permission") {
+		t.Errorf("gitea check = %+v", c)
+	}
+}
+
+func TestBackendConfig(t *testing.T) {
+	for _, config := range []Config{
+		{Backend: "gitea"},
+		{Backend: "svn"},
+		{Backend: "gitlab", IssueAfter: 3},
+	} {
+		if _, err := NewApp(config, nil, nil); err == nil {
+			t.Errorf("NewApp accepted %+v", config)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/google/go-github/github"
+)
+
+// githubBackend commits through the GitHub Git Data API: a tree on top of
+// the base tree, a commit and a fast forward of the branch.
+type githubBackend struct {
+	client              *github.Client
+	http                *http.Client
+	owner, repo, branch string
+}
+
+func (b *githubBackend) Head(ctx context.Context) (*Snapshot, error) {
+	ref, _, err := b.client.Git.GetRef(ctx, b.owner, b.repo, "heads/"+b.branch)
+	if err != nil {
+		return nil, fmt.Errorf("git getref error: %s", err)
+	}
+	return b.snapshot(ctx, *ref.Object.SHA)
+}
+
+// snapshot lists the files of commit sha, which may be abbreviated.
+func (b *githubBackend) snapshot(ctx context.Context, sha string) (*Snapshot, error) {
+	repoCommit, _, err := b.client.Repositories.GetCommit(ctx, b.owner, b.repo, sha)
+	if err != nil {
+		return nil, fmt.Errorf("git getcommit error: %s", err)
+	}
+	s := &Snapshot{Commit: repoCommit.GetSHA(), Tree: *repoCommit.Commit.Tree.SHA, Files: map[string]string{}}
+	if err := b.listTree(ctx, s.Tree, "", s.Files); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// gitTree is a tree of the Git Data API with the truncated flag the
+// vendored go-github drops.
+type gitTree struct {
+	Entries   []github.TreeEntry `json:"tree"`
+	Truncated bool               `json:"truncated"`
+}
+
+// listTree adds the blobs of tree sha to files, their paths below prefix.
+// GitHub truncates the recursive listing of large trees, the subtrees of
+// those are then listed one by one.
+func (b *githubBackend) listTree(ctx context.Context, sha, prefix string, files map[string]string) error {
+	tree, err := b.getTree(ctx, sha, true)
+	if err != nil {
+		return err
+	}
+	walk := tree.Truncated
+	if walk {
+		if tree, err = b.getTree(ctx, sha, false); err != nil {
+			return err
+		}
+		if tree.Truncated {
+			return fmt.Errorf("tree %s/%s is too large to list", sha, prefix)
+		}
+	}
+	for _, e := range tree.Entries {
+		switch {
+		case e.GetType() == "blob":
+			files[prefix+e.GetPath()] = e.GetSHA()
+		case e.GetType() == "tree" && walk:
+			if err := b.listTree(ctx, e.GetSHA(), prefix+e.GetPath()+"/", files); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *githubBackend) getTree(ctx context.Context, sha string, recursive bool) (*gitTree, error) {
+	u := fmt.Sprintf("repos/%s/%s/git/trees/%s", b.owner, b.repo, sha)
+	if recursive {
+		u += "?recursive=1"
+	}
+	req, err := b.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	tree := &gitTree{}
+	if _, err := b.client.Do(ctx, req, tree); err != nil {
+		return nil, fmt.Errorf("git gettree error: %s", err)
+	}
+	return tree, nil
+}
+
+func (b *githubBackend) ReadFile(ctx context.Context, s *Snapshot, path string) ([]byte, error) {
+	blob, _, err := b.client.Git.GetBlob(ctx, b.owner, b.repo, s.Files[path])
+	if err != nil {
+		return nil, fmt.Errorf("git getblob error: %s", err)
+	}
+	if blob.GetEncoding() != "base64" {
+		return []byte(blob.GetContent()), nil
+	}
+	return base64.StdEncoding.DecodeString(blob.GetContent())
+}
+
+// Commit sends text files inline with the tree, binary ones are uploaded
+// as base64 blobs first.
+func (b *githubBackend) Commit(ctx context.Context, base *Snapshot, message string, changes []Change) (string, error) {
+	trees := Tree{BaseTree: base.Tree}
+	for _, c := range changes {
+		entry := TreeEntry{Type: "blob", Mode: "100644", Path: c.Path}
+		if c.Delete {
+			entry.Delete = true
+		} else if utf8.Valid(c.Content) {
+			entry.Content = string(c.Content)
+		} else {
+			content := base64.StdEncoding.EncodeToString(c.Content)
+			encoding := "base64"
+			blob, _, err := b.client.Git.CreateBlob(ctx, b.owner, b.repo, &github.Blob{Content: &content, Encoding: &encoding})
+			if err != nil {
+				return "", fmt.Errorf("git createblob error: %s", err)
+			}
+			entry.SHA = blob.GetSHA()
+		}
+		trees.Entries = append(trees.Entries, entry)
+	}
+	treeSHA, err := b.createTree(ctx, trees)
+	if err != nil {
+		return "", err
+	}
+	if treeSHA == base.Tree {
+		return base.Commit, nil
+	}
+	// New commit grab the sha
+	commitSHA, err := b.createCommit(ctx, message, treeSHA, base.Commit)
+	if err != nil {
+		return "", err
+	}
+	// Update refs, refused when someone else moved the branch.
+	if err := b.updateRefs(ctx, commitSHA); err != nil {
+		if hasStatus(err, http.StatusUnprocessableEntity) {
+			return "", staleHead(base, err)
+		}
+		return "", err
+	}
+	return commitSHA, nil
+}
+
+// Check looks up the permission of the token's user on the backup
+// repository.
+func (b *githubBackend) Check(ctx context.Context) (string, error) {
+	user, _, err := b.client.Users.Get(ctx, "")
+	if err != nil {
+		return "", fmt.Errorf("cannot identify the token user: %s", err)
+	}
+	level, _, err := b.client.Repositories.GetPermissionLevel(ctx, b.owner, b.repo, user.GetLogin())
+	if err != nil {
+		return "", fmt.Errorf("cannot read the permission of %s: %s", user.GetLogin(), err)
+	}
+	permission := level.GetPermission()
+	if permission != "admin" && permission != "write" {
+		return "", fmt.Errorf("%s has %s permission on %s/%s, write is needed", user.GetLogin(), permission, b.owner, b.repo)
+	}
+	return fmt.Sprintf("%s can write to %s/%s", user.GetLogin(), b.owner, b.repo), nil
+}
+
+// repoURL returns the Git Data API url for path in the backup repository.
+func (b *githubBackend) repoURL(path string) string {
+	return fmt.Sprintf("%srepos/%s/%s/git/%s", b.client.BaseURL, b.owner, b.repo, path)
+}
+
+func (b *githubBackend) createTree(ctx context.Context, trees Tree) (string, error) {
+	treeJson, err := json.Marshal(trees)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal tree %s", err)
+	}
+	body, err := b.githubRequest(ctx, "POST", b.repoURL("trees"), "201 Created", treeJson)
+	if err != nil {
+		return "", err
+	}
+	treeResult := SHA{}
+	if err := json.Unmarshal(body, &treeResult); err != nil {
+		return "", fmt.Errorf("failed to decode resp.Body %s", err)
+	}
+	return treeResult.SHA, nil
+}
+
+func (b *githubBackend) createCommit(ctx context.Context, message, treeSHA, parent string) (string, error) {
+	payload := fmt.Sprintf("{ \"message\": %q, \"tree\": %q, \"parents\": [ %q ] }", message, treeSHA, parent)
+	body, err := b.githubRequest(ctx, "POST", b.repoURL("commits"), "201 Created", []byte(payload))
+	if err != nil {
+		return "", err
+	}
+	commitSHAs := SHA{}
+	if err := json.Unmarshal(body, &commitSHAs); err != nil {
+		return "", fmt.Errorf("failed to decode resp.Body %s", err)
+	}
+	return commitSHAs.SHA, nil
+}
+
+func (b *githubBackend) updateRefs(ctx context.Context, commitSHA string) error {
+	payload := fmt.Sprintf("{ \"sha\": %q }", commitSHA)
+	body, err := b.githubRequest(ctx, "PATCH", b.repoURL("refs/heads/"+b.branch), "200 OK", []byte(payload))
+	if err != nil {
+		return err
+	}
+	updateResult := GithubRefResult{}
+	if err := json.Unmarshal(body, &updateResult); err != nil {
+		return fmt.Errorf("failed to decode resp.Body %s", err)
+	}
+	return nil
+}
+
+func (b *githubBackend) githubRequest(ctx context.Context, verb, u, status string, input []byte) ([]byte, error) {
+	req, err := http.NewRequest(verb, u, bytes.NewBuffer(input))
+	if err != nil {
+		return nil, fmt.Errorf("cannot make request for %s: %s", u, err)
+	}
+	resp, err := b.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("cannot %s %s: %s", verb, u, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to readall body %s", err)
+	}
+
+	if resp.Status != status {
+		return nil, &apiError{resp.StatusCode, fmt.Sprintf("failed status test, got %s, error body:\n %s", resp.Status, body)}
+	}
+	return body, nil
+}
@@ -0,0 +1,83 @@
+package backup
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestGitHubBackendCommit(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	before := env.github.Head("master")
+	base, err := env.app.backend.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.Commit != before.SHA || base.Tree != before.Tree || base.Files["README.md"] == "" {
+		t.Errorf("head = %+v, want commit %s tree %s", base, before.SHA, before.Tree)
+	}
+
+	commit, err := env.app.backend.Commit(ctx, base, "test", []Change{
+		{Path: "topic/playlist.json", Content: []byte("[]")},
+		{Path: "topic/Floods.json", Content: []byte("{}")},
+		{Path: "thumbnails/a.png", Content: []byte("\x89PNG\r\n\x1a\n\xff")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head := env.github.Head("master")
+	if head.SHA != commit || head.Message != "test" || head.Parents[0] != before.SHA {
+		t.Errorf("head = %+v, backend made %s", head, commit)
+	}
+	files := env.github.Files(head.SHA)
+	if files["README.md"] == "" || files["topic/playlist.json"] != "[]" || files["topic/Floods.json"] != "{}" {
+		t.Errorf("tree = %v", files)
+	}
+	if files["thumbnails/a.png"] != "\x89PNG\r\n\x1a\n\xff" {
+		t.Errorf("binary file = %q", files["thumbnails/a.png"])
+	}
+	if n := env.github.Requests["POST /repos/rwapps/video_backups/git/blobs"]; n != 1 {
+		t.Errorf("uploaded %d blobs, want the binary one", n)
+	}
+	content, err := env.app.backend.ReadFile(ctx, &Snapshot{Files: map[string]string{"a": blobSHA([]byte("{}"))}}, "a")
+	if err != nil || string(content) != "{}" {
+		t.Errorf("read %q, %v", content, err)
+	}
+}
+
+func TestGitHubBackendCommitRejected(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	base, err := env.app.backend.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Someone else moved the branch, the update is no longer a fast forward.
+	env.github.SetFiles("master", "concurrent", map[string]string{"other": "x"})
+	if _, err := env.app.backend.Commit(ctx, base, "test", []Change{{Path: "topic/playlist.json", Content: []byte("[]")}}); err == nil || !strings.Contains(err.Error(), "moved since") {
+		t.Errorf("non fast forward update: %v", err)
+	}
+}
+
+func TestGitHubBackendTruncatedTree(t *testing.T) {
+	env := newTestEnv(t)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := env.github.Files(env.github.Head("master").SHA)
+	env.github.TruncateTrees = 2
+	s, err := env.app.backend.Head(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files) != len(want) {
+		t.Errorf("listed %d files of a truncated tree, want %d", len(s.Files), len(want))
+	}
+	for path := range want {
+		if _, ok := s.Files[path]; !ok {
+			t.Errorf("%s missing", path)
+		}
+	}
+}
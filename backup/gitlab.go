@@ -0,0 +1,162 @@
+package backup
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// gitlabBackend commits through the GitLab commits API, a single commit
+// with one action per file.
+type gitlabBackend struct {
+	http *http.Client
+	// base is the API root, project the owner/repo path.
+	base, project, branch string
+}
+
+// gitlabAction is a file action of a GitLab commit.
+type gitlabAction struct {
+	Action   string `json:"action"`
+	FilePath string `json:"file_path"`
+	// LastCommitId is the commit the file is known at, GitLab refuses
+	// to update or delete it when it changed since.
+	LastCommitId string `json:"last_commit_id,omitempty"`
+	Content      string `json:"content,omitempty"`
+	Encoding     string `json:"encoding,omitempty"`
+}
+
+// projectURL returns the url of path below the project, the project itself
+// when path is empty.
+func (b *gitlabBackend) projectURL(path string) string {
+	u := fmt.Sprintf("%s/projects/%s", b.base, url.PathEscape(b.project))
+	if path != "" {
+		u += "/" + path
+	}
+	return u
+}
+
+func (b *gitlabBackend) Head(ctx context.Context) (*Snapshot, error) {
+	var branch struct {
+		Commit struct {
+			Id string `json:"id"`
+		} `json:"commit"`
+	}
+	if _, _, err := apiRequest(ctx, b.http, "GET", b.projectURL("repository/branches/"+url.PathEscape(b.branch)), nil, &branch); err != nil {
+		return nil, fmt.Errorf("gitlab branch error: %s", err)
+	}
+	s := &Snapshot{Commit: branch.Commit.Id, Files: map[string]string{}}
+	for page := "1"; page != ""; {
+		q := url.Values{}
+		q.Set("ref", s.Commit)
+		q.Set("recursive", "true")
+		q.Set("per_page", "100")
+		q.Set("page", page)
+		var entries []struct {
+			Id   string `json:"id"`
+			Type string `json:"type"`
+			Path string `json:"path"`
+		}
+		header, _, err := apiRequest(ctx, b.http, "GET", b.projectURL("repository/tree?"+q.Encode()), nil, &entries)
+		if err != nil {
+			return nil, fmt.Errorf("gitlab tree error: %s", err)
+		}
+		for _, e := range entries {
+			if e.Type == "blob" {
+				s.Files[e.Path] = e.Id
+			}
+		}
+		page = header.Get("X-Next-Page")
+	}
+	return s, nil
+}
+
+func (b *gitlabBackend) ReadFile(ctx context.Context, s *Snapshot, path string) ([]byte, error) {
+	_, data, err := apiRequest(ctx, b.http, "GET", b.projectURL("repository/blobs/"+s.Files[path]+"/raw"), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("gitlab blob error: %s", err)
+	}
+	return data, nil
+}
+
+// Commit applies the changed files to the branch. Files that exist in base
+// are updated or deleted as of base, the others created, so GitLab refuses
+// to overwrite a file someone else changed or added since.
+func (b *gitlabBackend) Commit(ctx context.Context, base *Snapshot, message string, changes []Change) (string, error) {
+	changes = changed(base, changes)
+	if len(changes) == 0 {
+		return base.Commit, nil
+	}
+	var actions []gitlabAction
+	for _, c := range changes {
+		if c.Delete {
+			actions = append(actions, gitlabAction{Action: "delete", FilePath: c.Path, LastCommitId: base.Commit})
+			continue
+		}
+		a := gitlabAction{Action: "create", FilePath: c.Path, Content: string(c.Content), Encoding: "text"}
+		if _, ok := base.Files[c.Path]; ok {
+			a.Action, a.LastCommitId = "update", base.Commit
+		}
+		if !utf8.Valid(c.Content) {
+			a.Content, a.Encoding = base64.StdEncoding.EncodeToString(c.Content), "base64"
+		}
+		actions = append(actions, a)
+	}
+	input := map[string]interface{}{
+		"branch":         b.branch,
+		"commit_message": message,
+		"actions":        actions,
+	}
+	var commit struct {
+		Id string `json:"id"`
+	}
+	if _, _, err := apiRequest(ctx, b.http, "POST", b.projectURL("repository/commits"), input, &commit); err != nil {
+		// GitLab answers 400 to actions on files changed since base.
+		if hasStatus(err, http.StatusBadRequest) && gitlabConflict(err) {
+			return "", staleHead(base, err)
+		}
+		return "", fmt.Errorf("gitlab commit error: %s", err)
+	}
+	return commit.Id, nil
+}
+
+// gitlabConflict tells the refused actions from other bad requests.
+func gitlabConflict(err error) bool {
+	for _, message := range []string{"already exists", "doesn't exist", "has changed since"} {
+		if strings.Contains(err.Error(), message) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check needs the Developer role, the lowest allowed to push.
+func (b *gitlabBackend) Check(ctx context.Context) (string, error) {
+	var project struct {
+		Permissions struct {
+			ProjectAccess *struct {
+				AccessLevel int `json:"access_level"`
+			} `json:"project_access"`
+			GroupAccess *struct {
+				AccessLevel int `json:"access_level"`
+			} `json:"group_access"`
+		} `json:"permissions"`
+	}
+	if _, _, err := apiRequest(ctx, b.http, "GET", b.projectURL(""), nil, &project); err != nil {
+		return "", fmt.Errorf("cannot read project %s: %s", b.project, err)
+	}
+	level := 0
+	if p := project.Permissions.ProjectAccess; p != nil && p.AccessLevel > level {
+		level = p.AccessLevel
+	}
+	if g := project.Permissions.GroupAccess; g != nil && g.AccessLevel > level {
+		level = g.AccessLevel
+	}
+	if level < 30 {
+		return "", fmt.Errorf("access level %d on %s, 30 (Developer) is needed", level, b.project)
+	}
+	return fmt.Sprintf("access level %d on %s", level, b.project), nil
+}
@@ -0,0 +1,140 @@
+package backup
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rwapps/video_gists/internal/fake"
+)
+
+// bearer authenticates requests like the oauth2 client of main.
+type bearer struct {
+	token string
+}
+
+func (b *bearer) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newGitLabApp backs up the fakes of env to a GitLab fake.
+func newGitLabApp(t *testing.T, env *testEnv) (*App, *fake.GitLab) {
+	gitlab := fake.NewGitLab("rwapps/video_backups", "master", map[string]string{"README.md": "video backups\n"})
+	gitlab.Token = "gitlab-token"
+	gitlab.PageSize = 2
+	t.Cleanup(gitlab.Close)
+	config := env.app.Config
+	config.Backend = "gitlab"
+	config.GitLabURL = gitlab.URL + "/api/v4"
+	app, err := NewApp(config, nil, &http.Client{Transport: &bearer{"gitlab-token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.YoutubeAPIKey = "test-key"
+	return app, gitlab
+}
+
+func TestGitLabBackendRun(t *testing.T) {
+	env := newTestEnv(t)
+	app, gitlab := newGitLabApp(t, env)
+	before := gitlab.Head()
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	head := gitlab.Head()
+	if head.SHA == before.SHA || head.Message != "updating playlists" || app.LastRun.Commit != head.SHA {
+		t.Fatalf("head = %+v after %+v", head, app.LastRun)
+	}
+	files := gitlab.Files()
+	readPlaylistFile(t, files, "topic/Floods.json")
+	readPlaylistFile(t, files, "organization/OCHA.json")
+	if files["README.md"] != "video backups\n" {
+		t.Error("README.md was lost")
+	}
+
+	// Nothing changed, the second run reads the tree in pages and makes
+	// no commit.
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if gitlab.Head().SHA != head.SHA || app.LastRun.CommitResult != "empty" {
+		t.Errorf("unchanged run: %+v", app.LastRun)
+	}
+	// README.md alone, then 7 files and 3 directories in pages of 2.
+	if n := gitlab.Requests["GET repository/tree"]; n != 1+5 {
+		t.Errorf("listed the tree in %d requests, want 6", n)
+	}
+
+	// Only the changed playlist is updated.
+	env.youtube.SetPlaylist("PLocha", videos("ocha", 1))
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ocha := readPlaylistFile(t, gitlab.Files(), "organization/OCHA.json"); len(ocha.Videos) != 1 {
+		t.Errorf("organization playlist = %+v", ocha)
+	}
+	if n := gitlab.Requests["POST repository/commits"]; n != 2 {
+		t.Errorf("made %d commits, want 2", n)
+	}
+}
+
+func TestGitLabBackendCommit(t *testing.T) {
+	env := newTestEnv(t)
+	app, gitlab := newGitLabApp(t, env)
+	ctx := context.Background()
+	base, err := app.backend.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png := "\x89PNG\r\n\x1a\n\xff"
+	if _, err := app.backend.Commit(ctx, base, "test", []Change{
+		{Path: "README.md", Content: []byte("video backups\n")},
+		{Path: "thumbnails/a.png", Content: []byte(png)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := gitlab.Files()["thumbnails/a.png"]; got != png {
+		t.Errorf("binary file = %q", got)
+	}
+	head, err := app.backend.Head(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := app.backend.ReadFile(ctx, head, "thumbnails/a.png")
+	if err != nil || string(content) != png {
+		t.Errorf("read %q, %v", content, err)
+	}
+
+	// A file added since base is not overwritten.
+	gitlab.SetFiles("concurrent", map[string]string{"other": "x"})
+	if _, err := app.backend.Commit(ctx, head, "test", []Change{{Path: "other", Content: []byte("y")}}); err == nil || !strings.Contains(err.Error(), "moved since") {
+		t.Errorf("commit over a concurrent file: %v", err)
+	}
+	// Nor is a file changed since base.
+	files := gitlab.Files()
+	files["README.md"] = "changed\n"
+	gitlab.SetFiles("concurrent", files)
+	if _, err := app.backend.Commit(ctx, head, "test", []Change{{Path: "README.md", Content: []byte("mine\n")}}); err == nil || !strings.Contains(err.Error(), "moved since") {
+		t.Errorf("commit over a concurrent change: %v", err)
+	}
+	if got := gitlab.Files()["README.md"]; got != "changed\n" {
+		t.Errorf("README.md = %q", got)
+	}
+}
+
+func TestGitLabBackendCheck(t *testing.T) {
+	env := newTestEnv(t)
+	app, gitlab := newGitLabApp(t, env)
+	checks := checksByName(app.Preflight(context.Background()))
+	if c := checks["gitlab"]; !c.OK {
+		t.Errorf("gitlab check = %+v", c)
+	}
+	gitlab.AccessLevel = 20
+	checks = checksByName(app.Preflight(context.Background()))
+	if c := checks["gitlab"]; c.OK || !strings.Contains(c.Detail, "Developer") {
+		t.Errorf("gitlab check with the Reporter role = %+v", c)
+	}
+}
@@ -0,0 +1,185 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// PlaylistHistory lists the commits that changed the file of a playlist.
+type PlaylistHistory struct {
+	Category string `json:"category"`
+	Playlist string `json:"playlist"`
+	Path     string `json:"path"`
+	// Commits are the commits touching Path, newest first.
+	Commits []HistoryEntry `json:"commits"`
+}
+
+// HistoryEntry is a commit of a playlist file and the videos it added to
+// or removed from the playlist.
+type HistoryEntry struct {
+	Commit  string    `json:"commit"`
+	Date    time.Time `json:"date"`
+	Message string    `json:"message"`
+	Added   []Video   `json:"added"`
+	Removed []Video   `json:"removed"`
+	// Deleted is set when the commit removed the file.
+	Deleted bool `json:"deleted,omitempty"`
+	// Unchanged is set when the commit kept the videos of the playlist,
+	// changing only their titles, positions or dates.
+	Unchanged bool `json:"unchanged,omitempty"`
+}
+
+// History walks the commits of the playlist file of category, the
+// playlist being named by title or by its id in the current feed.
+func (a *App) History(ctx context.Context, category, playlist string) (*PlaylistHistory, error) {
+	b, err := a.historyBackend()
+	if err != nil {
+		return nil, err
+	}
+	title, err := b.playlistTitle(ctx, category, playlist)
+	if err != nil {
+		return nil, err
+	}
+	h := &PlaylistHistory{Category: category, Playlist: title, Path: playlistPath(category, title), Commits: []HistoryEntry{}}
+	commits, err := b.listCommits(ctx, h.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("no backup of %s", h.Path)
+	}
+
+	// The file of each commit is the previous version of the newer one.
+	files := make([]*PlaylistFile, len(commits)+1)
+	for i, c := range commits {
+		if files[i], err = b.readPlaylistAt(ctx, c.Commit.Tree.GetSHA(), h.Path); err != nil {
+			return nil, err
+		}
+	}
+	if oldest := commits[len(commits)-1]; len(oldest.Parents) > 0 {
+		parent, _, err := b.client.Git.GetCommit(ctx, b.owner, b.repo, oldest.Parents[0].GetSHA())
+		if err != nil {
+			return nil, fmt.Errorf("git getcommit error: %s", err)
+		}
+		if files[len(commits)], err = b.readPlaylistAt(ctx, parent.Tree.GetSHA(), h.Path); err != nil {
+			return nil, err
+		}
+	}
+	for i, c := range commits {
+		e := HistoryEntry{Commit: c.GetSHA(), Date: commitDate(c), Message: c.Commit.GetMessage(), Deleted: files[i] == nil}
+		var previous, current []Video
+		if files[i+1] != nil {
+			previous = files[i+1].Videos
+		}
+		if files[i] != nil {
+			current = files[i].Videos
+		}
+		e.Added, e.Removed, _ = diffVideos(previous, current)
+		e.Unchanged = len(e.Added) == 0 && len(e.Removed) == 0 && files[i] != nil && files[i+1] != nil
+		if e.Added == nil {
+			e.Added = []Video{}
+		}
+		if e.Removed == nil {
+			e.Removed = []Video{}
+		}
+		h.Commits = append(h.Commits, e)
+	}
+	return h, nil
+}
+
+// playlistTitle returns the title of the playlist with the given id in
+// the feed of category at the head, or playlist itself.
+func (b *githubBackend) playlistTitle(ctx context.Context, category, playlist string) (string, error) {
+	s, err := b.Head(ctx)
+	if err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("%s/playlist.json", category)
+	if _, ok := s.Files[path]; !ok {
+		return playlist, nil
+	}
+	content, err := b.ReadFile(ctx, s, path)
+	if err != nil {
+		return "", err
+	}
+	playlists, err := preparePlaylists(category, content)
+	if err != nil {
+		return "", fmt.Errorf("invalid archived %s: %s", path, err)
+	}
+	for _, p := range playlists {
+		if p.Id == playlist {
+			return p.Title, nil
+		}
+	}
+	return playlist, nil
+}
+
+// listCommits pages through the commits of the branch touching path.
+func (b *githubBackend) listCommits(ctx context.Context, path string) ([]*github.RepositoryCommit, error) {
+	opt := &github.CommitsListOptions{SHA: b.branch, Path: path, ListOptions: github.ListOptions{PerPage: 100}}
+	var commits []*github.RepositoryCommit
+	for {
+		page, resp, err := b.client.Repositories.ListCommits(ctx, b.owner, b.repo, opt)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list the commits of %s: %s", path, err)
+		}
+		commits = append(commits, page...)
+		if resp.NextPage == 0 {
+			return commits, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// readPlaylistAt parses the playlist file at path in the root tree sha,
+// nil when the tree has no such file. The blob is read through the Git
+// Data API, the contents API refusing files over 1 MB.
+func (b *githubBackend) readPlaylistAt(ctx context.Context, sha, path string) (*PlaylistFile, error) {
+	blob, err := b.blobAt(ctx, sha, path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s at %s: %s", path, sha, err)
+	}
+	if blob == "" {
+		return nil, nil
+	}
+	data, err := b.ReadFile(ctx, &Snapshot{Files: map[string]string{path: blob}}, path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s at %s: %s", path, sha, err)
+	}
+	var f PlaylistFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid %s at %s: %s", path, sha, err)
+	}
+	return &f, nil
+}
+
+// blobAt looks path up in the tree sha a directory at a time, returning
+// an empty sha when it is missing.
+func (b *githubBackend) blobAt(ctx context.Context, sha, path string) (string, error) {
+	names := strings.Split(path, "/")
+	for i, name := range names {
+		tree, err := b.getTree(ctx, sha, false)
+		if err != nil {
+			return "", err
+		}
+		want := "tree"
+		if i == len(names)-1 {
+			want = "blob"
+		}
+		sha = ""
+		for _, e := range tree.Entries {
+			if e.GetPath() == name && e.GetType() == want {
+				sha = e.GetSHA()
+			}
+		}
+		if sha == "" {
+			return "", nil
+		}
+	}
+	return sha, nil
+}
@@ -0,0 +1,94 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ids lists the ids of videos.
+func ids(videos []Video) string {
+	var out []string
+	for _, v := range videos {
+		out = append(out, v.Id)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestHistory(t *testing.T) {
+	env, commits := historyEnv(t)
+	for _, playlist := range []string{"Floods", "PLfloods"} {
+		h, err := env.app.History(context.Background(), "topic", playlist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Path != "topic/Floods.json" || len(h.Commits) != 3 {
+			t.Fatalf("history of %s = %+v", playlist, h)
+		}
+		for i, want := range []struct{ added, removed string }{
+			{"", "flood4"},
+			{"flood3,flood4", ""},
+			{"flood0,flood1,flood2", ""},
+		} {
+			c := h.Commits[i]
+			if c.Commit != commits[2-i] || ids(c.Added) != want.added || ids(c.Removed) != want.removed {
+				t.Errorf("commit %d = %s +%s -%s, want %s +%s -%s", i, c.Commit, ids(c.Added), ids(c.Removed), commits[2-i], want.added, want.removed)
+			}
+		}
+		if !h.Commits[0].Date.Equal(time.Date(2025, 3, 3, 10, 0, 0, 0, time.UTC)) || h.Commits[0].Message != commitMessage {
+			t.Errorf("newest commit = %+v", h.Commits[0])
+		}
+		// Scripts get empty lists rather than null.
+		data, err := json.Marshal(h.Commits[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `"added":[]`) {
+			t.Errorf("newest commit as JSON = %s", data)
+		}
+	}
+}
+
+func TestHistoryMarksUnchangedVideos(t *testing.T) {
+	env, commits := historyEnv(t)
+	files := env.github.Files(env.github.Head("master").SHA)
+	files["topic/Floods.json"] = strings.Replace(files["topic/Floods.json"], "flood video 0", "Flood video 0", 1)
+	retitled := env.github.SetFiles("master", "Retitle", files)
+	h, err := env.app.History(context.Background(), "topic", "Floods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Commits) != 4 || h.Commits[0].Commit != retitled || h.Commits[1].Commit != commits[2] {
+		t.Fatalf("history = %+v", h.Commits)
+	}
+	for i, c := range h.Commits {
+		if c.Unchanged != (i == 0) {
+			t.Errorf("commit %d unchanged = %t", i, c.Unchanged)
+		}
+	}
+}
+
+func TestHistoryOfLargeFile(t *testing.T) {
+	env, _ := historyEnv(t)
+	files := env.github.Files(env.github.Head("master").SHA)
+	large := fmt.Sprintf(`{"videos": [{"id": "large", "title": %q}]}`, strings.Repeat("x", 2<<20))
+	files["topic/Floods.json"] = large
+	env.github.SetFiles("master", "Large", files)
+	h, err := env.app.History(context.Background(), "topic", "Floods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(h.Commits[0].Added) != "large" {
+		t.Errorf("newest commit = %+v", h.Commits[0])
+	}
+}
+
+func TestHistoryUnknownPlaylist(t *testing.T) {
+	env, _ := historyEnv(t)
+	if _, err := env.app.History(context.Background(), "topic", "Earthquakes"); err == nil {
+		t.Error("history of a playlist never backed up")
+	}
+}
@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// videoIndexPath lists every video of the archive with the playlists it
+// appears in.
+const videoIndexPath = "videos/index.json"
+
+// VideoIndex is the content of videos/index.json, keyed by video id.
+type VideoIndex struct {
+	Videos map[string]*IndexedVideo `json:"videos"`
+}
+
+// IndexedVideo is a video and every playlist it belongs to.
+type IndexedVideo struct {
+	Id          string       `json:"id"`
+	Title       string       `json:"title"`
+	Thumbnail   string       `json:"thumbnail,omitempty"`
+	Memberships []Membership `json:"memberships"`
+}
+
+// Membership places a video in a playlist.
+type Membership struct {
+	Category string `json:"category"`
+	Playlist string `json:"playlist"`
+	Title    string `json:"title"`
+	Path     string `json:"path"`
+	Position int    `json:"position"`
+}
+
+func (x *VideoIndex) add(m Membership, v Video) {
+	e, ok := x.Videos[v.Id]
+	if !ok {
+		e = &IndexedVideo{Id: v.Id, Title: v.Title}
+		x.Videos[v.Id] = e
+	}
+	// Prefer a real title over the placeholder of an unavailable copy.
+	if e.Title != v.Title && unavailableTitles[e.Title] && !v.Unavailable() {
+		e.Title = v.Title
+	}
+	if e.Thumbnail == "" {
+		e.Thumbnail = v.Thumbnail
+	}
+	m.Position = v.Position
+	e.Memberships = append(e.Memberships, m)
+}
+
+// updateVideoIndex regenerates the index from the playlists of every
+// category feed. Playlists the run did not back up are taken from the
+// previous index, or their file when it is missing there, so a partial run
+// still writes a complete index.
+func (a *App) updateVideoIndex(ctx context.Context) error {
+	if len(a.backedUp) == 0 {
+		return nil
+	}
+	content, err := a.readBase(ctx, videoIndexPath)
+	if err != nil {
+		return err
+	}
+	previous := map[string][]Video{}
+	if content != nil {
+		var old VideoIndex
+		if err := json.Unmarshal(content, &old); err != nil {
+			log.Printf("ignoring invalid %s: %s\n", videoIndexPath, err)
+		}
+		for _, v := range old.Videos {
+			for _, m := range v.Memberships {
+				previous[m.Path] = append(previous[m.Path], Video{Id: v.Id, Title: v.Title, Position: m.Position, Thumbnail: v.Thumbnail})
+			}
+		}
+	}
+
+	index := VideoIndex{Videos: map[string]*IndexedVideo{}}
+	for _, category := range a.Config.Categories {
+		playlists, err := a.feedPlaylists(ctx, category)
+		if err != nil {
+			return err
+		}
+		for _, p := range playlists {
+			path := playlistPath(category, p.Title)
+			videos, ok := a.backedUp[path]
+			if !ok {
+				videos, ok = previous[path]
+			}
+			if !ok {
+				f, err := a.readBasePlaylist(ctx, path)
+				if err != nil {
+					return err
+				}
+				if f == nil {
+					continue
+				}
+				videos = f.Videos
+			}
+			for _, v := range videos {
+				index.add(Membership{Category: category, Playlist: p.Id, Title: p.Title, Path: path}, v)
+			}
+		}
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if string(data) != string(content) {
+		a.addToTree(videoIndexPath, string(data))
+	}
+	return nil
+}
+
+// feedPlaylists returns the playlists of category, from the feed fetched
+// by the run or else the archived one.
+func (a *App) feedPlaylists(ctx context.Context, category string) ([]Playlist, error) {
+	if playlists, ok := a.feeds[category]; ok {
+		return playlists, nil
+	}
+	path := fmt.Sprintf("%s/playlist.json", category)
+	content, err := a.readBase(ctx, path)
+	if err != nil || content == nil {
+		return nil, err
+	}
+	playlists, err := preparePlaylists(category, content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archived %s: %s", path, err)
+	}
+	return playlists, nil
+}
@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/rwapps/video_gists/internal/fake"
+)
+
+func readVideoIndex(t *testing.T, env *testEnv) VideoIndex {
+	t.Helper()
+	var index VideoIndex
+	files := env.github.Files(env.github.Head("master").SHA)
+	if err := json.Unmarshal([]byte(files[videoIndexPath]), &index); err != nil {
+		t.Fatalf("%s: %s", videoIndexPath, err)
+	}
+	return index
+}
+
+func TestVideoIndex(t *testing.T) {
+	env := newTestEnv(t)
+	env.youtube.SetPlaylist("PLocha", []fake.Video{
+		{Id: "ocha0", Title: "Private video"},
+		{Id: "flood1", Title: "Private video"},
+	})
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	index := readVideoIndex(t, env)
+	if n := len(index.Videos); n != 7+2+1 {
+		t.Errorf("indexed %d videos, want 10", n)
+	}
+	shared := index.Videos["flood1"]
+	if shared == nil {
+		t.Fatal("flood1 missing from the index")
+	}
+	if shared.Title != "flood video 1" {
+		t.Errorf("title = %q, want the available one", shared.Title)
+	}
+	want := []Membership{
+		{Category: "topic", Playlist: "PLfloods", Title: "Floods", Path: "topic/Floods.json", Position: 1},
+		{Category: "organization", Playlist: "PLocha", Title: "OCHA", Path: "organization/OCHA.json", Position: 1},
+	}
+	if !reflect.DeepEqual(shared.Memberships, want) {
+		t.Errorf("memberships = %+v, want %+v", shared.Memberships, want)
+	}
+
+	// A partial run keeps the playlists it did not fetch.
+	env.youtube.SetPlaylist("PLrefugees", []fake.Video{{Id: "flood1", Title: "flood video 1"}})
+	env.app.Selection.Playlists = ParseList("PLrefugees")
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	index = readVideoIndex(t, env)
+	if _, ok := index.Videos["refugee0"]; ok {
+		t.Error("refugee0 left the playlist but is still indexed")
+	}
+	if _, ok := index.Videos["flood6"]; !ok {
+		t.Error("the floods playlist was dropped from the index")
+	}
+	if n := len(index.Videos["flood1"].Memberships); n != 3 {
+		t.Errorf("flood1 has %d memberships, want 3", n)
+	}
+}
@@ -0,0 +1,288 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// failuresPath keeps the consecutive failures in the backup repository, so
+// the counts survive between runs wherever the tool runs.
+const failuresPath = runStateDir + "failures.json"
+
+// failureRecord counts the consecutive failed runs of a playlist or feed.
+type failureRecord struct {
+	Category  string    `json:"category"`
+	Playlist  string    `json:"playlist,omitempty"`
+	Title     string    `json:"title"`
+	Count     int       `json:"count"`
+	Since     time.Time `json:"since"`
+	LastError string    `json:"lastError"`
+	Issue     int       `json:"issue,omitempty"`
+}
+
+// key identifies what failed, a feed has no playlist id.
+func (r *failureRecord) key() string {
+	if r.Playlist == "" {
+		return r.Category + "/playlist.json"
+	}
+	return r.Category + "/" + r.Playlist
+}
+
+func (r *failureRecord) issueTitle() string {
+	if r.Playlist == "" {
+		return fmt.Sprintf("Backup failing: %s feed", r.Category)
+	}
+	return fmt.Sprintf("Backup failing: %s/%s", r.Category, r.Title)
+}
+
+// marker lets an issue be found again if the failure file is lost.
+func (r *failureRecord) marker() string {
+	return markerStart + r.key() + markerEnd
+}
+
+const markerStart, markerEnd = "<!-- video-backup: ", " -->"
+
+// issueKey is the record key in the marker of issue, empty without one.
+func issueKey(issue *github.Issue) string {
+	body := issue.GetBody()
+	i := strings.Index(body, markerStart)
+	if i < 0 {
+		return ""
+	}
+	body = body[i+len(markerStart):]
+	if i = strings.Index(body, markerEnd); i < 0 {
+		return ""
+	}
+	return body[:i]
+}
+
+func (r *failureRecord) issueBody() string {
+	what := fmt.Sprintf("The %s feed", r.Category)
+	if r.Playlist != "" {
+		what = fmt.Sprintf("The playlist %q (%s) of %s", r.Title, r.Playlist, r.Category)
+	}
+	return fmt.Sprintf("%s failed to back up in the last %d runs, since %s.\n\nLast error:\n\n```\n%s\n```\n\nThis issue closes itself once a backup succeeds.\n\n%s",
+		what, r.Count, r.Since.UTC().Format(time.RFC3339), r.LastError, r.marker())
+}
+
+// issueUpdates are the issue changes of a run, made once the failure
+// counts are committed.
+type issueUpdates struct {
+	// records are the failures still counted, report those to open or
+	// update an issue for, resolved the comments closing the issues of
+	// the records dropped by the run.
+	records  map[string]*failureRecord
+	report   []*failureRecord
+	resolved map[string]string
+	// open are the open issues, listed is false if they could not be.
+	open   []*github.Issue
+	listed bool
+}
+
+// trackFailures updates the consecutive failure counts with the run, to
+// be committed with it, and prepares the issue changes updateIssues
+// makes after the commit.
+func (a *App) trackFailures(ctx context.Context, s *Summary) {
+	if a.Config.IssueAfter <= 0 {
+		return
+	}
+	records := map[string]*failureRecord{}
+	content, err := a.readBase(ctx, failuresPath)
+	if err != nil {
+		log.Printf("cannot read %s: %s\n", failuresPath, err)
+		return
+	}
+	if content != nil {
+		var list []*failureRecord
+		if err := json.Unmarshal(content, &list); err != nil {
+			log.Printf("ignoring invalid %s: %s\n", failuresPath, err)
+		}
+		for _, r := range list {
+			records[r.key()] = r
+		}
+	}
+
+	u := &issueUpdates{records: records, resolved: map[string]string{}}
+	fail := func(r *failureRecord, msg string) {
+		if old, ok := records[r.key()]; ok {
+			r.Count, r.Since, r.Issue = old.Count, old.Since, old.Issue
+		} else {
+			r.Since = s.Start
+		}
+		r.Count++
+		r.LastError = msg
+		records[r.key()] = r
+		if r.Count >= a.Config.IssueAfter {
+			u.report = append(u.report, r)
+		}
+	}
+	resolve := func(key, comment string) {
+		if _, ok := records[key]; ok {
+			u.resolved[key] = comment
+			delete(records, key)
+		}
+	}
+	succeed := func(key string) {
+		if r, ok := records[key]; ok {
+			resolve(key, fmt.Sprintf("Backed up successfully again after %d failed runs.", r.Count))
+		}
+	}
+
+	for _, c := range s.Categories {
+		feed := &failureRecord{Category: c.Name, Title: c.Name}
+		if c.FeedError != "" {
+			fail(feed, c.FeedError)
+			continue
+		}
+		succeed(feed.key())
+		for _, f := range c.Failures {
+			fail(&failureRecord{Category: c.Name, Playlist: f.Playlist, Title: f.Title}, f.Error)
+		}
+		for _, id := range c.succeeded {
+			succeed(c.Name + "/" + id)
+		}
+	}
+	// A playlist dropped from its feed will never back up again.
+	for key, r := range records {
+		playlists, ok := a.feeds[r.Category]
+		if r.Playlist == "" || !ok || inFeed(playlists, r.Playlist) {
+			continue
+		}
+		resolve(key, fmt.Sprintf("The playlist was removed from the %s feed and is no longer backed up.", r.Category))
+	}
+
+	// The issues are only read before the commit, so that the numbers of
+	// those found by their marker are recorded.
+	u.open, err = a.openIssues(ctx)
+	if err != nil {
+		log.Printf("cannot list issues: %s\n", err)
+	} else {
+		u.listed = true
+		for _, r := range u.report {
+			for _, i := range u.open {
+				if r.Issue == 0 && issueKey(i) == r.key() {
+					r.Issue = i.GetNumber()
+				}
+			}
+		}
+	}
+	a.issues = u
+
+	if content == nil && len(records) == 0 {
+		return
+	}
+	list := []*failureRecord{}
+	for _, r := range records {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].key() < list[j].key() })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		log.Printf("cannot encode %s: %s\n", failuresPath, err)
+		return
+	}
+	if string(data) != string(content) {
+		a.addToTree(failuresPath, string(data))
+	}
+}
+
+// openIssues lists the open issues carrying the failure label.
+func (a *App) openIssues(ctx context.Context) ([]*github.Issue, error) {
+	opt := &github.IssueListByRepoOptions{
+		State:       "open",
+		Labels:      []string{a.Config.IssueLabel},
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	var all []*github.Issue
+	for {
+		issues, resp, err := a.github.Issues.ListByRepo(ctx, a.Config.Owner, a.Config.Repo, opt)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, issues...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// updateIssues opens, updates or closes the issues prepared by
+// trackFailures once the run is committed. An open issue of a failure no
+// longer counted is closed, whichever run dropped it. Problems with the
+// issues are logged, they never fail the backup.
+func (a *App) updateIssues(ctx context.Context) {
+	u := a.issues
+	if u == nil {
+		return
+	}
+	for _, i := range u.open {
+		key := issueKey(i)
+		if key == "" || u.records[key] != nil {
+			continue
+		}
+		comment, ok := u.resolved[key]
+		if !ok {
+			comment = "The backup no longer fails."
+		}
+		if err := a.closeIssue(ctx, i.GetNumber(), comment); err != nil {
+			log.Printf("cannot close issue #%d: %s\n", i.GetNumber(), err)
+		}
+	}
+	// Without the list an issue may exist that the run would duplicate.
+	if !u.listed {
+		return
+	}
+	for _, r := range u.report {
+		if err := a.reportFailure(ctx, r); err != nil {
+			log.Printf("cannot report %s: %s\n", r.key(), err)
+		}
+	}
+}
+
+// reportFailure updates the issue of r, reopened if it was closed since,
+// or opens one if there is none.
+func (a *App) reportFailure(ctx context.Context, r *failureRecord) error {
+	title, body := r.issueTitle(), r.issueBody()
+	if r.Issue != 0 {
+		state := "open"
+		_, _, err := a.github.Issues.Edit(ctx, a.Config.Owner, a.Config.Repo, r.Issue, &github.IssueRequest{Title: &title, Body: &body, State: &state})
+		return err
+	}
+	labels := []string{a.Config.IssueLabel}
+	issue, _, err := a.github.Issues.Create(ctx, a.Config.Owner, a.Config.Repo, &github.IssueRequest{Title: &title, Body: &body, Labels: &labels})
+	if err != nil {
+		return err
+	}
+	r.Issue = issue.GetNumber()
+	log.Printf("opened issue #%d for %s\n", r.Issue, r.key())
+	return nil
+}
+
+// inFeed reports whether the playlist id is in playlists.
+func inFeed(playlists []Playlist, id string) bool {
+	for _, p := range playlists {
+		if p.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// closeIssue closes the issue number of a record that no longer fails,
+// saying why in comment.
+func (a *App) closeIssue(ctx context.Context, number int, comment string) error {
+	if _, _, err := a.github.Issues.CreateComment(ctx, a.Config.Owner, a.Config.Repo, number, &github.IssueComment{Body: &comment}); err != nil {
+		return err
+	}
+	closed := "closed"
+	_, _, err := a.github.Issues.Edit(ctx, a.Config.Owner, a.Config.Repo, number, &github.IssueRequest{State: &closed})
+	return err
+}
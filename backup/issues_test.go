@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/rwapps/video_gists/internal/fake"
+)
+
+func TestIssuesForPersistentFailures(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.Config.IssueAfter = 2
+	env.reliefweb.SetFeed("topic", `[
+		{"title": "Floods", "id": "PLfloods"},
+		{"title": "Gone", "id": "PLgone"}
+	]`)
+	run := func() {
+		t.Helper()
+		if err := env.app.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	failures := func() []failureRecord {
+		t.Helper()
+		var records []failureRecord
+		content := env.github.Files(env.github.Head("master").SHA)[failuresPath]
+		if err := json.Unmarshal([]byte(content), &records); err != nil {
+			t.Fatalf("%s: %s", failuresPath, err)
+		}
+		return records
+	}
+
+	run()
+	if n := len(env.github.Issues()); n != 0 {
+		t.Fatalf("opened %d issues after the first failure", n)
+	}
+	if r := failures(); len(r) != 1 || r[0].Playlist != "PLgone" || r[0].Count != 1 {
+		t.Fatalf("failures = %+v", r)
+	}
+
+	run()
+	run()
+	issues := env.github.Issues()
+	if len(issues) != 1 {
+		t.Fatalf("got %d issues, want 1", len(issues))
+	}
+	issue := issues[0]
+	if issue.State != "open" || issue.Title != "Backup failing: topic/Gone" || len(issue.Labels) != 1 || issue.Labels[0] != "backup-failure" {
+		t.Errorf("issue = %+v", issue)
+	}
+	if !strings.Contains(issue.Body, "last 3 runs") || !strings.Contains(issue.Body, "404 Not Found") {
+		t.Errorf("issue body = %s", issue.Body)
+	}
+
+	env.youtube.SetPlaylist("PLgone", []fake.Video{{Id: "back", Title: "Back"}})
+	run()
+	issue = env.github.Issues()[0]
+	if issue.State != "closed" || len(issue.Comments) != 1 {
+		t.Errorf("issue = %+v, want closed with a comment", issue)
+	}
+	if r := failures(); len(r) != 0 {
+		t.Errorf("failures = %+v after the recovery", r)
+	}
+}
+
+func TestIssuesClosedForRemovedPlaylist(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.Config.IssueAfter = 1
+	env.reliefweb.SetFeed("topic", `[
+		{"title": "Floods", "id": "PLfloods"},
+		{"title": "Gone", "id": "PLgone"}
+	]`)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if issues := env.github.Issues(); len(issues) != 1 || issues[0].State != "open" {
+		t.Fatalf("issues = %+v", issues)
+	}
+
+	env.reliefweb.SetFeed("topic", `[{"title": "Floods", "id": "PLfloods"}]`)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	issue := env.github.Issues()[0]
+	if issue.State != "closed" || len(issue.Comments) != 1 || !strings.Contains(issue.Comments[0], "removed from the topic feed") {
+		t.Errorf("issue = %+v, want closed as removed", issue)
+	}
+	if content := env.github.Files(env.github.Head("master").SHA)[failuresPath]; strings.Contains(content, "PLgone") {
+		t.Errorf("%s still tracks PLgone: %s", failuresPath, content)
+	}
+}
+
+func TestIssuesFindExistingIssue(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.Config.IssueAfter = 1
+	env.reliefweb.SetFeed("organization", "<html>")
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Losing the failure file must not open a duplicate.
+	files := env.github.Files(env.github.Head("master").SHA)
+	delete(files, failuresPath)
+	env.github.SetFiles("master", "lost state", files)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	issues := env.github.Issues()
+	if len(issues) != 1 || issues[0].Title != "Backup failing: organization feed" {
+		t.Fatalf("issues = %+v", issues)
+	}
+	if !strings.Contains(issues[0].Body, "in the last 1 runs") {
+		t.Errorf("body = %s", issues[0].Body)
+	}
+	if _, ok := env.github.Files(env.github.Head("master").SHA)["organization/playlist.json"]; ok {
+		t.Error("the invalid feed was archived")
+	}
+}
+
+func TestIssuesAfterCommit(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.Config.IssueAfter = 1
+	env.reliefweb.SetFeed("organization", "<html>")
+	backend := env.app.backend
+	env.app.backend = failingCommit{backend}
+	if err := env.app.Run(context.Background()); err == nil {
+		t.Fatal("the run did not fail")
+	}
+	if issues := env.github.Issues(); len(issues) != 0 {
+		t.Fatalf("opened %d issues without a commit", len(issues))
+	}
+
+	env.app.backend = backend
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	issues := env.github.Issues()
+	if len(issues) != 1 || !strings.Contains(issues[0].Body, "in the last 1 runs") {
+		t.Fatalf("issues = %+v", issues)
+	}
+	// The next run records the number of the issue, closing it by hand
+	// while the feed still fails then reopens it.
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	closed := "closed"
+	if _, _, err := env.app.github.Issues.Edit(context.Background(), env.app.Config.Owner, env.app.Config.Repo, 1, &github.IssueRequest{State: &closed}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	issues = env.github.Issues()
+	if len(issues) != 1 || issues[0].State != "open" || !strings.Contains(issues[0].Body, "in the last 3 runs") {
+		t.Errorf("issues = %+v", issues)
+	}
+}
@@ -0,0 +1,177 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// localBackend commits into a git repository on disk, bare or not, with
+// the git plumbing commands, leaving the push to the operator. The work
+// tree of a non-bare repository is left alone.
+type localBackend struct {
+	gitDir, branch string
+}
+
+// newLocalBackend finds the git directory of the repository at path.
+func newLocalBackend(path, branch string) (*localBackend, error) {
+	if path == "" {
+		return nil, fmt.Errorf("the local backend needs LocalRepo")
+	}
+	gitDir := filepath.Join(path, ".git")
+	if _, err := os.Stat(gitDir); err != nil {
+		gitDir = path
+	}
+	return &localBackend{gitDir: gitDir, branch: branch}, nil
+}
+
+// git runs a git command on the repository with extra environment
+// variables and stdin, returning its output.
+func (b *localBackend) git(ctx context.Context, env []string, stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"--git-dir", b.gitDir}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %s: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// gitLine runs a git command printing a single line.
+func (b *localBackend) gitLine(ctx context.Context, env []string, stdin []byte, args ...string) (string, error) {
+	out, err := b.git(ctx, env, stdin, args...)
+	return strings.TrimSpace(string(out)), err
+}
+
+func (b *localBackend) ref() string {
+	return "refs/heads/" + b.branch
+}
+
+// Head resolves the branch, which may not exist yet in a new repository.
+func (b *localBackend) Head(ctx context.Context) (*Snapshot, error) {
+	s := &Snapshot{Files: map[string]string{}}
+	err := exec.CommandContext(ctx, "git", "--git-dir", b.gitDir, "show-ref", "--verify", "--quiet", b.ref()).Run()
+	if e, ok := err.(*exec.ExitError); ok && e.ExitCode() == 1 {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s of %s: %s", b.ref(), b.gitDir, err)
+	}
+	if s.Commit, err = b.gitLine(ctx, nil, nil, "rev-parse", "--verify", b.ref()+"^{commit}"); err != nil {
+		return nil, err
+	}
+	if s.Tree, err = b.gitLine(ctx, nil, nil, "rev-parse", "--verify", s.Commit+"^{tree}"); err != nil {
+		return nil, err
+	}
+	out, err := b.git(ctx, nil, nil, "ls-tree", "-r", "-z", s.Commit)
+	if err != nil {
+		return nil, err
+	}
+	// Each entry is "<mode> <type> <sha>\t<path>".
+	for _, entry := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+		i := strings.IndexByte(entry, '\t')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(entry[:i])
+		if len(fields) == 3 && fields[1] == "blob" {
+			s.Files[entry[i+1:]] = fields[2]
+		}
+	}
+	return s, nil
+}
+
+func (b *localBackend) ReadFile(ctx context.Context, s *Snapshot, path string) ([]byte, error) {
+	return b.git(ctx, nil, nil, "cat-file", "blob", s.Files[path])
+}
+
+// Commit writes the blobs, builds the tree in a temporary index and moves
+// the branch only if it still points at base.
+func (b *localBackend) Commit(ctx context.Context, base *Snapshot, message string, changes []Change) (string, error) {
+	dir, err := ioutil.TempDir("", "video-backup-index")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(dir, "index")}
+	if base.Tree != "" {
+		_, err = b.git(ctx, env, nil, "read-tree", base.Tree)
+	} else {
+		_, err = b.git(ctx, env, nil, "read-tree", "--empty")
+	}
+	if err != nil {
+		return "", err
+	}
+	var info bytes.Buffer
+	for _, c := range changes {
+		if c.Delete {
+			// A zero mode removes the path from the index.
+			fmt.Fprintf(&info, "0 %040d\t%s\x00", 0, c.Path)
+			continue
+		}
+		sha, err := b.gitLine(ctx, nil, c.Content, "hash-object", "-w", "--stdin")
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&info, "100644 %s\t%s\x00", sha, c.Path)
+	}
+	if _, err := b.git(ctx, env, info.Bytes(), "update-index", "-z", "--index-info"); err != nil {
+		return "", err
+	}
+	tree, err := b.gitLine(ctx, env, nil, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	if tree == base.Tree {
+		return base.Commit, nil
+	}
+	args := []string{"commit-tree", tree, "-m", message}
+	if base.Commit != "" {
+		args = append(args, "-p", base.Commit)
+	}
+	commit, err := b.gitLine(ctx, b.identity(ctx), nil, args...)
+	if err != nil {
+		return "", err
+	}
+	// An empty old value requires a new branch.
+	if _, err := b.git(ctx, nil, nil, "update-ref", "-m", message, b.ref(), commit, base.Commit); err != nil {
+		return "", staleHead(base, err)
+	}
+	return commit, nil
+}
+
+// identity names the committer when neither the environment nor the git
+// configuration does.
+func (b *localBackend) identity(ctx context.Context) []string {
+	if _, err := b.git(ctx, nil, nil, "var", "GIT_COMMITTER_IDENT"); err == nil {
+		return nil
+	}
+	return []string{
+		"GIT_AUTHOR_NAME=video backup", "GIT_AUTHOR_EMAIL=video-backup@localhost",
+		"GIT_COMMITTER_NAME=video backup", "GIT_COMMITTER_EMAIL=video-backup@localhost",
+	}
+}
+
+// Check makes sure the path is a repository whose objects can be written.
+func (b *localBackend) Check(ctx context.Context) (string, error) {
+	if _, err := b.git(ctx, nil, nil, "rev-parse", "--git-dir"); err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(filepath.Join(b.gitDir, "objects"), ".check")
+	if err != nil {
+		return "", fmt.Errorf("cannot write to %s: %s", b.gitDir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return "can write to " + b.gitDir, nil
+}
@@ -0,0 +1,121 @@
+package backup
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// git runs a git command in dir for the tests.
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(cmd.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@localhost", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@localhost")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// newLocalApp backs up the fakes of env to the repository at dir.
+func newLocalApp(t *testing.T, env *testEnv, dir string) *App {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	config := env.app.Config
+	config.Backend = "local"
+	config.LocalRepo = dir
+	app, err := NewApp(config, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.YoutubeAPIKey = "test-key"
+	return app
+}
+
+// localFiles reads the files of the branch of dir.
+func localFiles(t *testing.T, dir string) map[string]string {
+	files := map[string]string{}
+	for _, path := range strings.Split(git(t, dir, "ls-tree", "-r", "--name-only", "master"), "\n") {
+		files[path] = git(t, dir, "show", "master:"+path)
+	}
+	return files
+}
+
+func TestLocalBackendBare(t *testing.T) {
+	env := newTestEnv(t)
+	dir := t.TempDir()
+	git(t, dir, "init", "--bare", "--initial-branch=master")
+	app := newLocalApp(t, env, dir)
+	if _, err := app.backend.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	first := git(t, dir, "rev-parse", "master")
+	if app.LastRun.Commit != first || git(t, dir, "log", "-1", "--format=%s", "master") != "updating playlists" {
+		t.Fatalf("branch at %s after %+v", first, app.LastRun)
+	}
+	readPlaylistFile(t, localFiles(t, dir), "topic/Floods.json")
+	git(t, dir, "fsck", "--strict")
+
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if app.LastRun.CommitResult != "empty" || git(t, dir, "rev-parse", "master") != first {
+		t.Errorf("unchanged run moved the branch: %+v", app.LastRun)
+	}
+
+	env.youtube.SetPlaylist("PLfloods", videos("flood", 2))
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if parent := git(t, dir, "rev-parse", "master^"); parent != first {
+		t.Errorf("second commit has parent %s, want %s", parent, first)
+	}
+	if floods := readPlaylistFile(t, localFiles(t, dir), "topic/Floods.json"); len(floods.Videos) != 2 {
+		t.Errorf("floods playlist = %+v", floods)
+	}
+}
+
+func TestLocalBackendWorkTree(t *testing.T) {
+	env := newTestEnv(t)
+	dir := t.TempDir()
+	git(t, dir, "init", "--initial-branch=master")
+	git(t, dir, "commit", "--allow-empty", "-m", "initial")
+	app := newLocalApp(t, env, dir)
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if parent := git(t, dir, "log", "-1", "--format=%s", "master^"); parent != "initial" {
+		t.Errorf("backup parent = %q", parent)
+	}
+	if _, ok := localFiles(t, dir)["topic/Floods.json"]; !ok {
+		t.Error("topic/Floods.json was not committed")
+	}
+}
+
+func TestLocalBackendMovedBranch(t *testing.T) {
+	env := newTestEnv(t)
+	dir := t.TempDir()
+	git(t, dir, "init", "--bare", "--initial-branch=master")
+	app := newLocalApp(t, env, dir)
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	base, err := app.backend.Head(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.backend.Commit(context.Background(), base, "elsewhere", []Change{{Path: "other.txt", Content: []byte("other\n")}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.backend.Commit(context.Background(), base, "stale", []Change{{Path: "stale.txt", Content: []byte("stale\n")}}); err == nil || !strings.Contains(err.Error(), "moved since") {
+		t.Errorf("commit on a stale base: %v", err)
+	}
+	if got := git(t, dir, "log", "-1", "--format=%s", "master"); got != "elsewhere" {
+		t.Errorf("branch at %q", got)
+	}
+}
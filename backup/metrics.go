@@ -0,0 +1,287 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// runDurationBuckets are the upper bounds, in seconds, of the run duration
+// histogram.
+var runDurationBuckets = []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+
+// Metrics collects run and API counters in the Prometheus text format.
+type Metrics struct {
+	mu sync.Mutex
+	// families maps a metric name to its series keyed by label string.
+	families map[string]*family
+	// The run duration histogram.
+	durationCounts []uint64
+	durationSum    float64
+	durationCount  uint64
+}
+
+type family struct {
+	help, kind string
+	series     map[string]float64
+}
+
+// NewMetrics returns an empty registry.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		families:       map[string]*family{},
+		durationCounts: make([]uint64, len(runDurationBuckets)),
+	}
+}
+
+// metricHelp documents every family, it also fixes their type.
+var metricHelp = map[string][2]string{
+	"video_backup_runs_total":                     {"counter", "Backup runs by result."},
+	"video_backup_last_success_timestamp_seconds": {"gauge", "Time of the last successful backup per category."},
+	"video_backup_playlists_fetched_total":        {"counter", "Playlists fetched per category."},
+	"video_backup_videos_fetched_total":           {"counter", "Videos fetched per category."},
+	"video_backup_playlist_failures_total":        {"counter", "Playlists that could not be backed up per category."},
+	"video_backup_api_calls_total":                {"counter", "Requests sent per upstream."},
+	"video_backup_api_errors_total":               {"counter", "Failed requests per upstream."},
+	"video_backup_api_quota_units_total":          {"counter", "Quota units spent per upstream."},
+	"video_backup_commits_total":                  {"counter", "Commit attempts by result."},
+	"video_backup_cache_hits_total":               {"counter", "Requests answered from the response cache per upstream."},
+	"video_backup_quota_saved_units_total":        {"counter", "Quota units not spent thanks to the response cache per upstream."},
+}
+
+// labelEscaper escapes label values as the text exposition format wants.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats name="value" pairs, keys are given in order.
+func labels(kv ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, kv[i], labelEscaper.Replace(kv[i+1])))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m *Metrics) family(name string) *family {
+	f, ok := m.families[name]
+	if !ok {
+		f = &family{kind: metricHelp[name][0], help: metricHelp[name][1], series: map[string]float64{}}
+		m.families[name] = f
+	}
+	return f
+}
+
+func (m *Metrics) add(name string, v float64, kv ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.family(name).series[labels(kv...)] += v
+}
+
+func (m *Metrics) set(name string, v float64, kv ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.family(name).series[labels(kv...)] = v
+}
+
+// apiCall counts a request to upstream.
+func (m *Metrics) apiCall(upstream string, units int, failed bool) {
+	m.add("video_backup_api_calls_total", 1, "upstream", upstream)
+	if failed {
+		m.add("video_backup_api_errors_total", 1, "upstream", upstream)
+	}
+	if units > 0 {
+		m.add("video_backup_api_quota_units_total", float64(units), "upstream", upstream)
+	}
+}
+
+// cacheHit counts a request answered from the cache.
+func (m *Metrics) cacheHit(upstream string, units int) {
+	m.add("video_backup_cache_hits_total", 1, "upstream", upstream)
+	if units > 0 {
+		m.add("video_backup_quota_saved_units_total", float64(units), "upstream", upstream)
+	}
+}
+
+// observeRun records a finished run.
+func (m *Metrics) observeRun(s *Summary, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.add("video_backup_runs_total", 1, "result", result)
+	m.add("video_backup_commits_total", 1, "result", s.CommitResult)
+	for _, c := range s.Categories {
+		m.add("video_backup_playlists_fetched_total", float64(c.Playlists), "category", c.Name)
+		m.add("video_backup_videos_fetched_total", float64(c.Videos), "category", c.Name)
+		m.add("video_backup_playlist_failures_total", float64(len(c.Failures)), "category", c.Name)
+		if err == nil && c.ok() {
+			m.set("video_backup_last_success_timestamp_seconds", float64(s.End.Unix()), "category", c.Name)
+		}
+	}
+
+	seconds := s.End.Sub(s.Start).Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, le := range runDurationBuckets {
+		if seconds <= le {
+			m.durationCounts[i]++
+		}
+	}
+	m.durationSum += seconds
+	m.durationCount++
+}
+
+// WriteTo writes every metric in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b bytes.Buffer
+	var names []string
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := m.families[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.kind)
+		var keys []string
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if k == "" {
+				fmt.Fprintf(&b, "%s %g\n", name, f.series[k])
+			} else {
+				fmt.Fprintf(&b, "%s{%s} %g\n", name, k, f.series[k])
+			}
+		}
+	}
+	name := "video_backup_run_duration_seconds"
+	fmt.Fprintf(&b, "# HELP %s Duration of backup runs.\n# TYPE %s histogram\n", name, name)
+	for i, le := range runDurationBuckets {
+		fmt.Fprintf(&b, "%s_bucket{le=\"%g\"} %d\n", name, le, m.durationCounts[i])
+	}
+	fmt.Fprintf(&b, "%s_bucket{le=\"+Inf\"} %d\n", name, m.durationCount)
+	fmt.Fprintf(&b, "%s_sum %g\n%s_count %d\n", name, m.durationSum, name, m.durationCount)
+	return b.WriteTo(w)
+}
+
+// ServeHTTP exposes the metrics for scraping.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// WriteFile writes the metrics for the node exporter textfile collector.
+// The file is replaced atomically so the collector never reads half of it.
+func (m *Metrics) WriteFile(path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".metrics")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := m.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// youtubeQuota is the quota cost of the YouTube Data API endpoints, keyed
+// by method and path below the API root.
+var youtubeQuota = map[string]int{
+	"GET playlistItems":  1,
+	"GET videos":         1,
+	"GET captions":       50,
+	"GET captions/{id}":  200,
+	"POST playlists":     50,
+	"POST playlistItems": 50,
+}
+
+// instrumented counts the requests of one client per upstream.
+type instrumented struct {
+	app  *App
+	base http.RoundTripper
+}
+
+func (t *instrumented) RoundTrip(req *http.Request) (*http.Response, error) {
+	upstream, units := t.app.upstream(req)
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusNotModified {
+		// Revalidated from the cache, counted as saved instead.
+		units = 0
+	}
+	t.app.Metrics.apiCall(upstream, units, err != nil || resp.StatusCode >= 400)
+	return resp, err
+}
+
+// under reports whether u is base or below it, returning the rest of the
+// path.
+func under(u, base string) (string, bool) {
+	base = strings.TrimSuffix(base, "/")
+	if !strings.HasPrefix(u, base) {
+		return "", false
+	}
+	rest := u[len(base):]
+	if rest != "" && rest[0] != '/' {
+		return "", false
+	}
+	return strings.Trim(rest, "/"), true
+}
+
+// upstream names the service a request goes to and what it costs.
+func (a *App) upstream(req *http.Request) (string, int) {
+	u := req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+	if path, ok := under(u, a.Config.YoutubeURL); ok {
+		if strings.HasPrefix(path, "captions/") {
+			path = "captions/{id}"
+		}
+		return "youtube", youtubeQuota[req.Method+" "+path]
+	}
+	if _, ok := under(u, a.Config.ReliefwebURL); ok {
+		return "reliefweb", 0
+	}
+	if _, ok := under(u, a.Config.GitHubUploadURL); ok {
+		return "github", 1
+	}
+	if _, ok := under(u, a.Config.GitHubURL); ok {
+		// One request of the hourly rate limit.
+		return "github", 1
+	}
+	if _, ok := under(u, a.Config.GitLabURL); ok {
+		return "gitlab", 0
+	}
+	if _, ok := under(u, a.Config.GiteaURL); ok && a.Config.GiteaURL != "" {
+		return "gitea", 0
+	}
+	for _, s := range a.Config.Sinks {
+		if _, ok := under(u, s.Endpoint); ok {
+			return "s3", 0
+		}
+	}
+	return req.URL.Host, 0
+}
+
+// instrument returns a copy of c counting its requests.
+func (a *App) instrument(c *http.Client) *http.Client {
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client := *c
+	client.Transport = &instrumented{app: a, base: base}
+	return &client
+}
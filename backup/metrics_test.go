@@ -0,0 +1,81 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetricsAfterRun(t *testing.T) {
+	env := newTestEnv(t)
+	env.youtube.PageSize = 3
+	env.reliefweb.SetFeed("topic", `[
+		{"title": "Floods", "id": "PLfloods"},
+		{"title": "Gone", "id": "PLgone"}
+	]`)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	env.app.Metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`video_backup_runs_total{result="success"} 1`,
+		`video_backup_commits_total{result="created"} 1`,
+		`video_backup_playlists_fetched_total{category="topic"} 1`,
+		`video_backup_playlists_fetched_total{category="organization"} 1`,
+		`video_backup_videos_fetched_total{category="topic"} 7`,
+		`video_backup_playlist_failures_total{category="topic"} 1`,
+		// Floods takes 3 pages, PLgone fails once and OCHA takes 1 page.
+		`video_backup_api_calls_total{upstream="youtube"} 5`,
+		`video_backup_api_errors_total{upstream="youtube"} 1`,
+		`video_backup_api_quota_units_total{upstream="youtube"} 5`,
+		`video_backup_api_calls_total{upstream="reliefweb"} 2`,
+		`video_backup_run_duration_seconds_count 1`,
+		`video_backup_last_success_timestamp_seconds{category="organization"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+	if strings.Contains(body, `video_backup_last_success_timestamp_seconds{category="topic"}`) {
+		t.Error("topic had a failure but got a success timestamp")
+	}
+}
+
+func TestMetricsWriteFile(t *testing.T) {
+	m := NewMetrics()
+	m.apiCall("github", 1, false)
+	path := filepath.Join(t.TempDir(), "video_backup.prom")
+	if err := m.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Errorf("file = %s, want %s", data, buf.Bytes())
+	}
+	if !strings.Contains(string(data), "# TYPE video_backup_api_calls_total counter\n") {
+		t.Errorf("missing TYPE line in %s", data)
+	}
+}
+
+func TestMetricsLabelEscaping(t *testing.T) {
+	m := NewMetrics()
+	m.add("video_backup_playlists_fetched_total", 1, "category", "Floods \"2024\" \\ Asia\nnew")
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	want := `video_backup_playlists_fetched_total{category="Floods \"2024\" \\ Asia\nnew"} 1`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("metrics lack %s in\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,201 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Notification sends the run summary to a webhook.
+type Notification struct {
+	// Type is "webhook" for the JSON summary or "slack" for an incoming
+	// webhook message.
+	Type string `json:"Type"`
+	URL  string `json:"URL"`
+	// When is "always", "failure" or "change", the last firing on
+	// failures as well as on added, removed or unavailable videos.
+	When string `json:"When"`
+}
+
+// notifyTimeout bounds the delivery of each notification.
+const notifyTimeout = 30 * time.Second
+
+// maxListed caps each list of a Slack message.
+const maxListed = 20
+
+// WebhookPayload is the body of the generic JSON webhook.
+type WebhookPayload struct {
+	Status  string   `json:"status"`
+	Text    string   `json:"text"`
+	Summary *Summary `json:"summary"`
+}
+
+// matches reports whether n fires for s.
+func (n Notification) matches(s *Summary) bool {
+	switch n.When {
+	case "", "always":
+		return true
+	case "failure":
+		return s.Failed()
+	case "change":
+		return s.Failed() || len(s.Changes()) > 0
+	}
+	return false
+}
+
+func (n Notification) validate() error {
+	switch n.Type {
+	case "webhook", "slack":
+	default:
+		return fmt.Errorf("unknown notification type %q", n.Type)
+	}
+	switch n.When {
+	case "", "always", "failure", "change":
+	default:
+		return fmt.Errorf("unknown notification rule %q", n.When)
+	}
+	if n.URL == "" {
+		return fmt.Errorf("%s notification without URL", n.Type)
+	}
+	return nil
+}
+
+// notify sends s to every matching notification, it runs after ctx may
+// have been cancelled so it uses its own deadline.
+func (a *App) notify(s *Summary) {
+	if a.NotifyClient == nil {
+		if len(a.Config.Notifications) > 0 {
+			log.Printf("notifications disabled, not sending them\n")
+		}
+		return
+	}
+	for _, n := range a.Config.Notifications {
+		if !n.matches(s) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		if err := a.sendNotification(ctx, n, s); err != nil {
+			log.Printf("failed to send %s notification: %s\n", n.Type, err)
+		}
+		cancel()
+	}
+}
+
+func (a *App) sendNotification(ctx context.Context, n Notification, s *Summary) error {
+	var payload interface{}
+	switch n.Type {
+	case "slack":
+		payload = map[string]string{"text": slackText(s)}
+	default:
+		payload = WebhookPayload{Status: status(s), Text: headline(s), Summary: s}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.NotifyClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, msg)
+	}
+	return nil
+}
+
+func status(s *Summary) string {
+	if s.Failed() {
+		return "failure"
+	}
+	return "success"
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// headline is a one line account of the run.
+func headline(s *Summary) string {
+	var removed, unavailable int
+	for _, c := range s.Changes() {
+		removed += len(c.Removed)
+		unavailable += len(c.Unavailable)
+	}
+	var playlists, videos int
+	for _, c := range s.Categories {
+		playlists += c.Playlists
+		videos += c.Videos
+	}
+	parts := []string{fmt.Sprintf("%s and %s backed up", plural(playlists, "playlist"), plural(videos, "video"))}
+	if n := len(s.Failures()); n > 0 {
+		parts = append(parts, plural(n, "playlist")+" failed")
+	}
+	for _, c := range s.Categories {
+		if c.FeedError != "" {
+			parts = append(parts, "the "+c.Name+" feed failed")
+		}
+	}
+	if removed > 0 {
+		parts = append(parts, plural(removed, "video")+" removed")
+	}
+	if unavailable > 0 {
+		parts = append(parts, plural(unavailable, "video")+" unavailable")
+	}
+	text := "Video backup " + status(s) + ": " + strings.Join(parts, ", ")
+	if s.Error != "" {
+		text += " (" + s.Error + ")"
+	}
+	return text
+}
+
+// slackText renders s with Slack mrkdwn.
+func slackText(s *Summary) string {
+	var b strings.Builder
+	b.WriteString(headline(s))
+	list := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n*%s*", title)
+		for i, l := range lines {
+			if i == maxListed {
+				fmt.Fprintf(&b, "\n…and %d more", len(lines)-maxListed)
+				break
+			}
+			b.WriteString("\n• " + l)
+		}
+	}
+	var failures, removed, unavailable []string
+	for _, f := range s.Failures() {
+		failures = append(failures, fmt.Sprintf("%s/%s (%s): %s", f.Category, f.Title, f.Playlist, f.Error))
+	}
+	for _, c := range s.Changes() {
+		for _, v := range c.Removed {
+			removed = append(removed, fmt.Sprintf("%s/%s: <https://youtu.be/%s|%s>", c.Category, c.Title, v.Id, v.Title))
+		}
+		for _, v := range c.Unavailable {
+			unavailable = append(unavailable, fmt.Sprintf("%s/%s: <https://youtu.be/%s|%s>", c.Category, c.Title, v.Id, v.Title))
+		}
+	}
+	list("Failures", failures)
+	list("Removed videos", removed)
+	list("Unavailable videos", unavailable)
+	return b.String()
+}
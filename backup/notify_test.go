@@ -0,0 +1,112 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rwapps/video_gists/internal/fake"
+)
+
+// receiver collects the bodies posted to it.
+type receiver struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies [][]byte
+}
+
+func newReceiver(t *testing.T) *receiver {
+	r := &receiver{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		r.mu.Lock()
+		r.bodies = append(r.bodies, body)
+		r.mu.Unlock()
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func TestNotifyRemovedVideos(t *testing.T) {
+	env := newTestEnv(t)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	webhook, slack, onFailure := newReceiver(t), newReceiver(t), newReceiver(t)
+	env.app.Config.Notifications = []Notification{
+		{Type: "webhook", URL: webhook.URL, When: "change"},
+		{Type: "slack", URL: slack.URL, When: "always"},
+		{Type: "webhook", URL: onFailure.URL, When: "failure"},
+	}
+	floods := videos("flood", 7)
+	floods[2].Title = "Private video"
+	env.youtube.SetPlaylist("PLfloods", append(floods[:4], fake.Video{Id: "new", Title: "New"}))
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(webhook.bodies) != 1 || len(slack.bodies) != 1 || len(onFailure.bodies) != 0 {
+		t.Fatalf("got %d webhook, %d slack and %d failure notifications", len(webhook.bodies), len(slack.bodies), len(onFailure.bodies))
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(webhook.bodies[0], &payload); err != nil {
+		t.Fatal(err)
+	}
+	changes := payload.Summary.Changes()
+	if payload.Status != "success" || len(changes) != 1 {
+		t.Fatalf("payload = %s", webhook.bodies[0])
+	}
+	c := changes[0]
+	if c.Playlist != "PLfloods" || len(c.Removed) != 3 || len(c.Added) != 1 || len(c.Unavailable) != 1 || c.Unavailable[0].Id != "flood2" {
+		t.Errorf("change = %+v", c)
+	}
+
+	var message struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(slack.bodies[0], &message); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"3 videos removed", "1 video unavailable", "<https://youtu.be/flood6|flood video 6>"} {
+		if !strings.Contains(message.Text, want) {
+			t.Errorf("slack text lacks %q:\n%s", want, message.Text)
+		}
+	}
+}
+
+func TestNotifyFailure(t *testing.T) {
+	env := newTestEnv(t)
+	onFailure, onChange := newReceiver(t), newReceiver(t)
+	env.app.Config.Notifications = []Notification{
+		{Type: "slack", URL: onFailure.URL, When: "failure"},
+		{Type: "webhook", URL: onChange.URL, When: "change"},
+	}
+	env.reliefweb.SetFeed("topic", `[{"title": "Gone", "id": "PLgone"}]`)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(onFailure.bodies) != 1 || len(onChange.bodies) != 1 {
+		t.Fatalf("got %d failure and %d change notifications", len(onFailure.bodies), len(onChange.bodies))
+	}
+	if !strings.Contains(string(onFailure.bodies[0]), "topic/Gone (PLgone)") {
+		t.Errorf("slack message = %s", onFailure.bodies[0])
+	}
+}
+
+func TestNotificationValidate(t *testing.T) {
+	for _, n := range []Notification{
+		{Type: "email", URL: "x"},
+		{Type: "slack", URL: "x", When: "sometimes"},
+		{Type: "webhook"},
+	} {
+		if _, err := NewApp(Config{Notifications: []Notification{n}}, nil, nil); err == nil {
+			t.Errorf("%+v: expected an error", n)
+		}
+	}
+}
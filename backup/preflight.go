@@ -0,0 +1,202 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Check is the result of one preflight check.
+type Check struct {
+	Name     string        `json:"name"`
+	OK       bool          `json:"ok"`
+	Detail   string        `json:"detail"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Preflight checks that the credentials and feeds a run depends on work,
+// at the cost of a few cheap requests: the token must be able to write to
+// the backup repository, the YouTube key must be valid with quota
+// left, every sink must accept the S3 keys and every category feed must
+// resolve.
+func (a *App) Preflight(ctx context.Context) []Check {
+	names := []string{a.Config.Backend, "youtube"}
+	checks := []func(context.Context) (string, error){a.backend.Check, a.checkYoutube}
+	for _, s := range a.sinks() {
+		names = append(names, s.Name())
+		checks = append(checks, s.Check)
+	}
+	for _, category := range a.Config.Categories {
+		category := category
+		names = append(names, "reliefweb/"+category)
+		checks = append(checks, func(ctx context.Context) (string, error) {
+			return a.checkFeed(ctx, category)
+		})
+	}
+
+	results := make([]Check, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check func(context.Context) (string, error)) {
+			defer wg.Done()
+			start := time.Now()
+			detail, err := check(ctx)
+			if err != nil {
+				detail = err.Error()
+			}
+			results[i] = Check{Name: names[i], OK: err == nil, Detail: detail, Duration: time.Since(start)}
+		}(i, check)
+	}
+	wg.Wait()
+	return results
+}
+
+// youtubeError is the error body of the Google APIs.
+type youtubeError struct {
+	Error struct {
+		Message string `json:"message"`
+		Errors  []struct {
+			Reason string `json:"reason"`
+		} `json:"errors"`
+	} `json:"error"`
+}
+
+// checkYoutube spends a single quota unit on a videos.list call, which
+// fails with keyInvalid or quotaExceeded when the key cannot be used.
+func (a *App) checkYoutube(ctx context.Context) (string, error) {
+	u, err := url.Parse(a.Config.YoutubeURL + "/videos")
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("part", "id")
+	q.Set("id", "preflight")
+	q.Set("key", a.YoutubeAPIKey)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := a.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return "API key is valid", nil
+	}
+	var body youtubeError
+	json.NewDecoder(resp.Body).Decode(&body)
+	reason := resp.Status
+	if len(body.Error.Errors) > 0 {
+		reason = body.Error.Errors[0].Reason
+	}
+	switch reason {
+	case "quotaExceeded", "dailyLimitExceeded", "rateLimitExceeded":
+		return "", fmt.Errorf("no quota left: %s", body.Error.Message)
+	case "keyInvalid", "keyExpired":
+		return "", fmt.Errorf("API key is invalid: %s", body.Error.Message)
+	}
+	return "", fmt.Errorf("videos.list returned %s: %s", reason, body.Error.Message)
+}
+
+// checkFeed makes sure the category feed resolves without downloading it.
+func (a *App) checkFeed(ctx context.Context, category string) (string, error) {
+	u := fmt.Sprintf("%s/%s.json", a.Config.ReliefwebURL, category)
+	req, err := http.NewRequest("HEAD", u, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := a.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", u, resp.Status)
+	}
+	return u + " resolves", nil
+}
+
+// Readiness caches the preflight checks so probes stay cheap.
+type Readiness struct {
+	App *App
+	// TTL is how long a result is reused.
+	TTL time.Duration
+	// Timeout bounds a run of the checks, a minute by default.
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	checks  []Check
+	// running is closed once the checks in progress are done.
+	running chan struct{}
+	last    []Check
+}
+
+// Checks returns the cached checks, running them again once stale. The
+// checks run on their own deadline, shared by concurrent probes, so a
+// probe giving up neither cancels them nor caches its failure.
+func (r *Readiness) Checks(ctx context.Context) []Check {
+	r.mu.Lock()
+	if r.checks != nil && time.Since(r.checked) <= r.TTL {
+		checks := r.checks
+		r.mu.Unlock()
+		return checks
+	}
+	if r.running == nil {
+		r.running = make(chan struct{})
+		go r.refresh(r.running)
+	}
+	running := r.running
+	r.mu.Unlock()
+
+	select {
+	case <-running:
+	case <-ctx.Done():
+		return []Check{{Name: "preflight", Detail: fmt.Sprintf("checks still running: %s", ctx.Err())}}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+// refresh runs the checks, caching them unless they ran out of time.
+func (r *Readiness) refresh(done chan struct{}) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	checks := r.App.Preflight(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = checks
+	if ctx.Err() == nil {
+		r.checks, r.checked = checks, time.Now()
+	}
+	r.running = nil
+	close(done)
+}
+
+// ServeHTTP answers 200 when every check passes and 503 otherwise, with
+// each result in the body.
+func (r *Readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	checks := r.Checks(req.Context())
+	status := http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"ready": status == http.StatusOK, "checks": checks})
+}
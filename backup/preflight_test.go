@@ -0,0 +1,112 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func checksByName(checks []Check) map[string]Check {
+	m := map[string]Check{}
+	for _, c := range checks {
+		m[c.Name] = c
+	}
+	return m
+}
+
+func TestPreflight(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.Config.Categories = append(env.app.Config.Categories, "country")
+	env.github.Permission = "read"
+	env.youtube.QuotaExceeded = true
+
+	checks := checksByName(env.app.Preflight(context.Background()))
+	want := map[string]string{
+		"github":                 "read permission",
+		"youtube":                "no quota left",
+		"reliefweb/topic":        "",
+		"reliefweb/organization": "",
+		"reliefweb/country":      "404 Not Found",
+	}
+	if len(checks) != len(want) {
+		t.Errorf("got %d checks, want %d", len(checks), len(want))
+	}
+	for name, detail := range want {
+		c, ok := checks[name]
+		switch {
+		case !ok:
+			t.Errorf("no %s check", name)
+		case detail == "" && !c.OK:
+			t.Errorf("%s failed: %s", name, c.Detail)
+		case detail != "" && (c.OK || !strings.Contains(c.Detail, detail)):
+			t.Errorf("%s = %+v, want a failure mentioning %q", name, c, detail)
+		}
+	}
+}
+
+func TestPreflightInvalidKey(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.YoutubeAPIKey = "wrong"
+	c := checksByName(env.app.Preflight(context.Background()))["youtube"]
+	if c.OK || !strings.Contains(c.Detail, "invalid") {
+		t.Errorf("youtube check = %+v", c)
+	}
+	if !checksByName(env.app.Preflight(context.Background()))["github"].OK {
+		t.Error("github check failed")
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	env := newTestEnv(t)
+	ready := &Readiness{App: env.app, TTL: time.Hour}
+
+	get := func() (int, []Check) {
+		rec := httptest.NewRecorder()
+		ready.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+		var body struct {
+			Checks []Check `json:"checks"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, body.Checks
+	}
+	if code, checks := get(); code != http.StatusOK || len(checks) != 4 {
+		t.Errorf("readyz = %d with %d checks", code, len(checks))
+	}
+	// Within the TTL the cached result is served without new requests.
+	env.youtube.QuotaExceeded = true
+	if code, _ := get(); code != http.StatusOK {
+		t.Errorf("cached readyz = %d", code)
+	}
+	if got := env.youtube.Requests["/videos"]; got != 1 {
+		t.Errorf("made %d videos requests, want 1", got)
+	}
+	ready.TTL = 0
+	if code, _ := get(); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz = %d after the quota ran out", code)
+	}
+}
+
+func TestReadinessCancelledProbe(t *testing.T) {
+	env := newTestEnv(t)
+	ready := &Readiness{App: env.app, TTL: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if checks := ready.Checks(ctx); len(checks) != 1 || checks[0].OK {
+		t.Errorf("cancelled probe = %+v", checks)
+	}
+	// The checks went on without the probe and their result is cached.
+	checks := ready.Checks(context.Background())
+	if len(checks) != 4 || !checksByName(checks)["youtube"].OK {
+		t.Errorf("checks = %+v", checks)
+	}
+	env.youtube.QuotaExceeded = true
+	if !checksByName(ready.Checks(context.Background()))["youtube"].OK {
+		t.Error("the checks were not cached")
+	}
+}
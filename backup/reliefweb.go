@@ -0,0 +1,60 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+)
+
+func (a *App) getRwPlaylists(ctx context.Context, category string) ([]byte, error) {
+	u := fmt.Sprintf("%s/%s.json", a.Config.ReliefwebURL, category)
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get url %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", u, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to readall body %s", err)
+	}
+	return body, nil
+}
+
+func preparePlaylists(category string, rwPlaylists []byte) ([]Playlist, error) {
+	var playlists []Playlist
+	if category == "organization" {
+		var orgPlaylists map[string]OrgPlaylist
+		if err := json.Unmarshal(rwPlaylists, &orgPlaylists); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal playlists: %s", err)
+		}
+		// Walk the map in key order so runs are reproducible.
+		var keys []string
+		for k := range orgPlaylists {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := orgPlaylists[k]
+			playlist := Playlist{}
+			playlist.Title = p.Title
+			playlist.Id = p.Id
+			playlist.DefaultImg = p.DefaultImg
+			playlists = append(playlists, playlist)
+		}
+	} else {
+		if err := json.Unmarshal(rwPlaylists, &playlists); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal playlists: %s", err)
+		}
+	}
+	return playlists, nil
+}
@@ -0,0 +1,40 @@
+package backup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPreparePlaylists(t *testing.T) {
+	topics, err := preparePlaylists("topic", []byte(topicFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 2 || topics[1].Title != "Refugees/Migrants Emergency - Europe" {
+		t.Errorf("topic playlists = %+v", topics)
+	}
+
+	orgs, err := preparePlaylists("organization", []byte(`{
+		"2": {"name": "WFP", "playlist_id": "PLwfp", "thumbnail_url": "wfp.jpg"},
+		"1": {"name": "OCHA", "playlist_id": "PLocha", "thumbnail_url": "ocha.jpg"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Playlist{
+		{Title: "OCHA", Id: "PLocha", DefaultImg: "ocha.jpg"},
+		{Title: "WFP", Id: "PLwfp", DefaultImg: "wfp.jpg"},
+	}
+	// Ordered by map key, not by feed order.
+	if !reflect.DeepEqual(orgs, want) {
+		t.Errorf("organization playlists = %+v, want %+v", orgs, want)
+	}
+}
+
+func TestPreparePlaylistsInvalid(t *testing.T) {
+	for _, category := range []string{"country", "organization"} {
+		if got, err := preparePlaylists(category, []byte("<html>")); err == nil {
+			t.Errorf("%s: got %+v from an invalid feed", category, got)
+		}
+	}
+}
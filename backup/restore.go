@@ -0,0 +1,81 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// RestoredFeed is a ReliefWeb playlist feed written back from the archive.
+type RestoredFeed struct {
+	Category  string `json:"category"`
+	Path      string `json:"path"`
+	Playlists int    `json:"playlists"`
+}
+
+// snapshotAt resolves at, a commit or a date, to a snapshot of the
+// backup, the head of the branch when empty.
+func (a *App) snapshotAt(ctx context.Context, at string) (*Snapshot, error) {
+	if at == "" {
+		return a.backend.Head(ctx)
+	}
+	b, err := a.historyBackend()
+	if err != nil {
+		return nil, err
+	}
+	c, err := b.commitAt(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	return b.snapshot(ctx, c.GetSHA())
+}
+
+// RestoreFeeds writes the archived feeds of the selected categories of
+// the backup at to dir as <category>.json, byte for byte what ReliefWeb
+// served: a list of playlists for most categories and a map of
+// OrgPlaylist for organization. Every feed is checked before any is
+// written, and an empty one is refused as it is likely what went wrong.
+func (a *App) RestoreFeeds(ctx context.Context, at, dir string) ([]RestoredFeed, error) {
+	s, err := a.snapshotAt(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	var feeds []RestoredFeed
+	var contents [][]byte
+	for _, category := range a.Config.Categories {
+		if !a.Selection.includesCategory(category) {
+			continue
+		}
+		path := fmt.Sprintf("%s/playlist.json", category)
+		if _, ok := s.Files[path]; !ok {
+			return nil, fmt.Errorf("%s is not archived in %.7s", path, s.Commit)
+		}
+		content, err := a.backend.ReadFile(ctx, s, path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %s", path, err)
+		}
+		playlists, err := preparePlaylists(category, content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archived %s in %.7s: %s", path, s.Commit, err)
+		}
+		if len(playlists) == 0 {
+			return nil, fmt.Errorf("%s is empty in %.7s, restore an earlier backup", path, s.Commit)
+		}
+		feeds = append(feeds, RestoredFeed{Category: category, Path: filepath.Join(dir, category+".json"), Playlists: len(playlists)})
+		contents = append(contents, content)
+	}
+	if len(feeds) == 0 {
+		return nil, fmt.Errorf("no category selected")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	for i, f := range feeds {
+		if err := ioutil.WriteFile(f.Path, contents[i], 0644); err != nil {
+			return nil, err
+		}
+	}
+	return feeds, nil
+}
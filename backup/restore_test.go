@@ -0,0 +1,58 @@
+package backup
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestoreFeeds(t *testing.T) {
+	env := newTestEnv(t)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "playlists")
+	feeds, err := env.app.RestoreFeeds(context.Background(), "", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 2 || feeds[0].Playlists != 2 || feeds[1].Playlists != 1 {
+		t.Fatalf("feeds = %+v", feeds)
+	}
+	for category, want := range map[string]string{"topic": topicFeed, "organization": organizationFeed} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, category+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s.json = %s, want the feed as served", category, data)
+		}
+	}
+}
+
+func TestRestoreFeedsSkipsEmptyFeed(t *testing.T) {
+	env := newTestEnv(t)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	good := env.app.LastRun.Commit
+	env.reliefweb.SetFeed("topic", "[]")
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	env.app.Selection.Categories = ParseList("topic")
+	if _, err := env.app.RestoreFeeds(context.Background(), "", dir); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("restoring the empty feed: %v", err)
+	}
+	feeds, err := env.app.RestoreFeeds(context.Background(), good, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].Category != "topic" || feeds[0].Playlists != 2 {
+		t.Errorf("feeds = %+v", feeds)
+	}
+}
@@ -0,0 +1,267 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// PlaylistRestore reports the recreation of a playlist on YouTube.
+type PlaylistRestore struct {
+	// Playlist is the id of the new playlist, empty on a dry run.
+	Playlist string `json:"playlist,omitempty"`
+	Title    string `json:"title"`
+	Privacy  string `json:"privacy"`
+	DryRun   bool   `json:"dryRun,omitempty"`
+	// Restored are the videos inserted, or to insert on a dry run, in
+	// their original order.
+	Restored []RestoredVideo `json:"restored"`
+	// Unrestorable are the videos left out with the reason why.
+	Unrestorable []RestoredVideo `json:"unrestorable"`
+}
+
+// RestoredVideo is a video of a restored playlist, Position being the
+// one it had in the backup.
+type RestoredVideo struct {
+	Id       string `json:"id"`
+	Title    string `json:"title"`
+	Position int    `json:"position"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// RestoreOptions tune RestorePlaylist.
+type RestoreOptions struct {
+	// Title of the new playlist, the archived one by default.
+	Title string
+	// Privacy is private, unlisted or public, private by default.
+	Privacy string
+	// DryRun only checks which videos are still available.
+	DryRun bool
+}
+
+// videosPerRequest is the most ids videos.list accepts at once.
+const videosPerRequest = 50
+
+// abortReasons are the YouTube errors ending a restore along with any
+// 401, 403 or server error, any other one only concerns the video being
+// inserted.
+var abortReasons = map[string]bool{
+	"quotaExceeded":      true,
+	"dailyLimitExceeded": true,
+	"rateLimitExceeded":  true,
+	"authError":          true,
+	"required":           true,
+	"playlistNotFound":   true,
+}
+
+// ArchivedPlaylist reads the playlist file of category in the backup at,
+// a commit or a date, the latest when empty. playlist is a title or an
+// id of the archived feed.
+func (a *App) ArchivedPlaylist(ctx context.Context, category, playlist, at string) (string, *PlaylistFile, error) {
+	s, err := a.snapshotAt(ctx, at)
+	if err != nil {
+		return "", nil, err
+	}
+	title := playlist
+	playlists, _, err := readFeed(ctx, a.backend, s, category)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, p := range playlists {
+		if p.Id == playlist {
+			title = p.Title
+		}
+	}
+	path := playlistPath(category, title)
+	f, err := readPlaylist(ctx, a.backend, s, path)
+	if err != nil {
+		return "", nil, err
+	}
+	if f == nil {
+		return "", nil, fmt.Errorf("no backup of %s in %.7s", path, s.Commit)
+	}
+	return title, f, nil
+}
+
+// RestorePlaylist creates a playlist titled title with the videos of f
+// still available on YouTube, in their original order. The videos that
+// cannot be inserted are reported instead of failing the restore, unless
+// YouTube refuses to go on, e.g. out of quota, when the report so far is
+// returned with the error.
+func (a *App) RestorePlaylist(ctx context.Context, title string, f *PlaylistFile, opts RestoreOptions) (*PlaylistRestore, error) {
+	if opts.Title != "" {
+		title = opts.Title
+	}
+	if title == "" {
+		return nil, fmt.Errorf("the restored playlist needs a title")
+	}
+	switch opts.Privacy {
+	case "":
+		opts.Privacy = "private"
+	case "private", "unlisted", "public":
+	default:
+		return nil, fmt.Errorf("unknown privacy status %q", opts.Privacy)
+	}
+	if !opts.DryRun && a.YoutubeOAuthClient == nil {
+		return nil, fmt.Errorf("restoring a playlist needs YouTube OAuth")
+	}
+	videos := append([]Video(nil), f.Videos...)
+	sort.SliceStable(videos, func(i, j int) bool { return videos[i].Position < videos[j].Position })
+	r := &PlaylistRestore{Title: title, Privacy: opts.Privacy, DryRun: opts.DryRun, Restored: []RestoredVideo{}, Unrestorable: []RestoredVideo{}}
+
+	var ids []string
+	for _, v := range videos {
+		ids = append(ids, v.Id)
+	}
+	statuses, err := a.videoStatuses(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("cannot check the videos: %s", err)
+	}
+	var available []RestoredVideo
+	for _, v := range videos {
+		rv := RestoredVideo{Id: v.Id, Title: v.Title, Position: v.Position}
+		switch status, ok := statuses[v.Id]; {
+		case !ok:
+			rv.Reason = "deleted or not found"
+		case status == "private":
+			rv.Reason = "private"
+		default:
+			available = append(available, rv)
+			continue
+		}
+		r.Unrestorable = append(r.Unrestorable, rv)
+	}
+	if opts.DryRun {
+		r.Restored = append(r.Restored, available...)
+		return r, nil
+	}
+
+	client := a.instrument(a.YoutubeOAuthClient)
+	var created struct {
+		Id string `json:"id"`
+	}
+	playlist := map[string]interface{}{
+		"snippet": map[string]string{"title": title},
+		"status":  map[string]string{"privacyStatus": opts.Privacy},
+	}
+	if _, _, err := a.youtubePost(ctx, client, "/playlists?part=snippet,status", playlist, &created); err != nil {
+		return nil, fmt.Errorf("cannot create the playlist: %s", err)
+	}
+	r.Playlist = created.Id
+	for i, v := range available {
+		item := map[string]interface{}{
+			"snippet": map[string]interface{}{
+				"playlistId": r.Playlist,
+				"position":   len(r.Restored),
+				"resourceId": map[string]string{"kind": "youtube#video", "videoId": v.Id},
+			},
+		}
+		status, reason, err := a.youtubePost(ctx, client, "/playlistItems?part=snippet", item, nil)
+		if err == nil {
+			r.Restored = append(r.Restored, v)
+			continue
+		}
+		if abortReasons[reason] || status == http.StatusUnauthorized || status == http.StatusForbidden || status >= 500 || ctx.Err() != nil {
+			for j, rest := range available[i:] {
+				rest.Reason = "not inserted, the restore stopped"
+				// A server error does not tell whether the insert
+				// happened, which is why it is not retried.
+				if j == 0 && status >= 500 {
+					rest.Reason = "maybe inserted, YouTube failed"
+				}
+				r.Unrestorable = append(r.Unrestorable, rest)
+			}
+			sort.SliceStable(r.Unrestorable, func(i, j int) bool { return r.Unrestorable[i].Position < r.Unrestorable[j].Position })
+			return r, fmt.Errorf("cannot insert %s: %s", v.Id, err)
+		}
+		v.Reason = reason
+		r.Unrestorable = append(r.Unrestorable, v)
+	}
+	sort.SliceStable(r.Unrestorable, func(i, j int) bool { return r.Unrestorable[i].Position < r.Unrestorable[j].Position })
+	return r, nil
+}
+
+// videoStatuses returns the privacy status of the videos of ids found
+// on YouTube, asking for them in batches.
+func (a *App) videoStatuses(ctx context.Context, ids []string) (map[string]string, error) {
+	statuses := map[string]string{}
+	var unique []string
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	for start := 0; start < len(unique); start += videosPerRequest {
+		end := start + videosPerRequest
+		if end > len(unique) {
+			end = len(unique)
+		}
+		q := url.Values{"part": {"status"}, "id": {strings.Join(unique[start:end], ",")}, "key": {a.YoutubeAPIKey}}
+		body, err := a.youtubeGet(ctx, "/videos?"+q.Encode())
+		if err != nil {
+			return nil, err
+		}
+		var list struct {
+			Items []struct {
+				Id     string `json:"id"`
+				Status struct {
+					PrivacyStatus string `json:"privacyStatus"`
+				} `json:"status"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			statuses[item.Id] = item.Status.PrivacyStatus
+		}
+	}
+	return statuses, nil
+}
+
+// youtubePost sends body to the YouTube Data API resource at path with
+// client, decoding the response into v when set. An error response is
+// returned with its status and reason, the status itself when the body
+// has none. Server errors are not retried, the inserts may have been
+// done anyway and would be repeated.
+func (a *App) youtubePost(ctx context.Context, client *http.Client, path string, body, v interface{}) (int, string, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return 0, "", err
+	}
+	req, err := http.NewRequest("POST", a.Config.YoutubeURL+path, bytes.NewReader(data))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to post to gapis %s", err)
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return 0, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e youtubeError
+		json.Unmarshal(content, &e)
+		if len(e.Error.Errors) > 0 {
+			reason := e.Error.Errors[0].Reason
+			return resp.StatusCode, reason, fmt.Errorf("gapis returned %s: %s", resp.Status, reason)
+		}
+		return resp.StatusCode, resp.Status, fmt.Errorf("gapis returned %s", resp.Status)
+	}
+	if v == nil {
+		return resp.StatusCode, "", nil
+	}
+	return resp.StatusCode, "", json.Unmarshal(content, v)
+}
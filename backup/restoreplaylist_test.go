@@ -0,0 +1,145 @@
+package backup
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// deletedFloodsEnv backs up the playlists, then deletes the Floods
+// playlist from YouTube along with flood5, flood3 having turned private.
+func deletedFloodsEnv(t *testing.T) *testEnv {
+	env := newTestEnv(t)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	floods := videos("flood", 7)
+	floods[3].Private = true
+	env.youtube.SetPlaylist("PLfloods", floods)
+	env.youtube.DeletePlaylist("PLfloods")
+	env.youtube.DeleteVideo("flood5")
+	env.youtube.OAuthToken = "oauth-token"
+	env.app.YoutubeOAuthClient = oauthClient("oauth-token")
+	return env
+}
+
+func videoIds(videos []RestoredVideo) []string {
+	var ids []string
+	for _, v := range videos {
+		ids = append(ids, v.Id)
+	}
+	return ids
+}
+
+func TestRestorePlaylist(t *testing.T) {
+	env := deletedFloodsEnv(t)
+	title, f, err := env.app.ArchivedPlaylist(context.Background(), "topic", "PLfloods", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Floods" || len(f.Videos) != 7 {
+		t.Fatalf("archived %q with %d videos", title, len(f.Videos))
+	}
+
+	r, err := env.app.RestorePlaylist(context.Background(), title, f, RestoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := env.youtube.Created()
+	if len(created) != 1 || created[0].Title != "Floods" || created[0].Privacy != "private" || r.Playlist != created[0].Id {
+		t.Fatalf("created %+v, restore %+v", created, r)
+	}
+	want := []string{"flood0", "flood1", "flood2", "flood4", "flood6"}
+	if ids := videoIds(r.Restored); !reflect.DeepEqual(ids, want) {
+		t.Errorf("restored %v, want %v", ids, want)
+	}
+	var items []string
+	for _, v := range env.youtube.Items(r.Playlist) {
+		items = append(items, v.Id)
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("playlist items %v, want %v", items, want)
+	}
+	wantUnrestorable := []RestoredVideo{
+		{Id: "flood3", Title: "flood video 3", Position: 3, Reason: "private"},
+		{Id: "flood5", Title: "flood video 5", Position: 5, Reason: "deleted or not found"},
+	}
+	if !reflect.DeepEqual(r.Unrestorable, wantUnrestorable) {
+		t.Errorf("unrestorable %+v", r.Unrestorable)
+	}
+}
+
+func TestRestorePlaylistDryRun(t *testing.T) {
+	env := deletedFloodsEnv(t)
+	env.app.YoutubeOAuthClient = nil
+	title, f, err := env.app.ArchivedPlaylist(context.Background(), "topic", "Floods", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := env.app.RestorePlaylist(context.Background(), title, f, RestoreOptions{DryRun: true, Title: "Floods (restored)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.DryRun || r.Playlist != "" || r.Title != "Floods (restored)" {
+		t.Errorf("restore %+v", r)
+	}
+	if ids := videoIds(r.Restored); len(ids) != 5 {
+		t.Errorf("would restore %v", ids)
+	}
+	if ids := videoIds(r.Unrestorable); !reflect.DeepEqual(ids, []string{"flood3", "flood5"}) {
+		t.Errorf("unrestorable %v", ids)
+	}
+	if len(env.youtube.Created()) != 0 || env.youtube.Requests["/playlists"] != 0 {
+		t.Errorf("dry run wrote to YouTube: %v", env.youtube.Requests)
+	}
+}
+
+func TestRestorePlaylistStops(t *testing.T) {
+	env := deletedFloodsEnv(t)
+	f := &PlaylistFile{Videos: []Video{{Id: "flood0", Position: 0}}}
+	env.app.YoutubeOAuthClient = nil
+	if _, err := env.app.RestorePlaylist(context.Background(), "Floods", f, RestoreOptions{}); err == nil || !strings.Contains(err.Error(), "OAuth") {
+		t.Errorf("restore without OAuth: %v", err)
+	}
+	env.app.YoutubeOAuthClient = oauthClient("revoked")
+	if _, err := env.app.RestorePlaylist(context.Background(), "Floods", f, RestoreOptions{}); err == nil || !strings.Contains(err.Error(), "authError") {
+		t.Errorf("restore with a revoked token: %v", err)
+	}
+	if _, err := env.app.RestorePlaylist(context.Background(), "Floods", f, RestoreOptions{Privacy: "secret"}); err == nil {
+		t.Error("restored with an unknown privacy status")
+	}
+	if len(env.youtube.Created()) != 0 {
+		t.Errorf("created %+v", env.youtube.Created())
+	}
+}
+
+// TestRestorePlaylistPlainErrors checks the errors without a JSON body,
+// from a proxy, stop the restore when YouTube is down or refusing.
+func TestRestorePlaylistPlainErrors(t *testing.T) {
+	f := &PlaylistFile{Videos: []Video{{Id: "flood0", Position: 0}, {Id: "flood1", Position: 1}}}
+	for _, c := range []struct {
+		errors   []int
+		restored int
+	}{
+		{[]int{http.StatusBadRequest}, 1},
+		{[]int{http.StatusForbidden}, 0},
+		{[]int{http.StatusUnauthorized}, 0},
+		{[]int{http.StatusBadGateway}, 0},
+	} {
+		env := deletedFloodsEnv(t)
+		env.youtube.PlainErrors = c.errors
+		before := env.youtube.Requests["/playlistItems"]
+		r, err := env.app.RestorePlaylist(context.Background(), "Floods", f, RestoreOptions{})
+		if c.restored == 0 && err == nil || c.restored > 0 && err != nil {
+			t.Errorf("restore with errors %v: %v", c.errors, err)
+		}
+		if r == nil || len(r.Restored) != c.restored || len(r.Restored)+len(r.Unrestorable) != 2 {
+			t.Errorf("restore with errors %v = %+v", c.errors, r)
+		}
+		if n := env.youtube.Requests["/playlistItems"] - before; n != 1+c.restored {
+			t.Errorf("restore with errors %v sent %d insertions", c.errors, n)
+		}
+	}
+}
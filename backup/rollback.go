@@ -0,0 +1,183 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RollbackResult describes a rollback commit.
+type RollbackResult struct {
+	// Commit is the new head, Target the commit whose files it restores.
+	Commit string    `json:"commit"`
+	Target string    `json:"target"`
+	Date   time.Time `json:"date"`
+	// Changed counts the files added, modified or deleted.
+	Changed int `json:"changed"`
+}
+
+// Rollback commits on top of the branch the files of the backup at to,
+// a commit or a date, so history is kept and no force push is needed.
+// With selected categories only their directories are restored. The
+// state of the runs below .backup/ is kept and videos/index.json follows
+// the restored playlists. reason, when set, is added to the commit
+// message.
+func (a *App) Rollback(ctx context.Context, to, reason string) (*RollbackResult, error) {
+	b, err := a.historyBackend()
+	if err != nil {
+		return nil, err
+	}
+	c, err := b.commitAt(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	head, err := b.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+	target, err := b.snapshot(ctx, c.GetSHA())
+	if err != nil {
+		return nil, err
+	}
+	result := &RollbackResult{Commit: head.Commit, Target: target.Commit, Date: commitDate(c)}
+
+	var categories []string
+	for category := range a.Selection.Categories {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	inScope := func(path string) bool {
+		if strings.HasPrefix(path, runStateDir) || path == videoIndexPath {
+			return false
+		}
+		return len(categories) == 0 || a.Selection.includesCategory(strings.SplitN(path, "/", 2)[0])
+	}
+	files := map[string]string{}
+	for path, sha := range head.Files {
+		if !inScope(path) && path != videoIndexPath {
+			files[path] = sha
+		}
+	}
+	for path, sha := range target.Files {
+		if inScope(path) {
+			files[path] = sha
+		}
+	}
+	index, err := rollbackIndex(ctx, b, head, target, categories)
+	if err != nil {
+		return nil, err
+	}
+	if index != nil {
+		files[videoIndexPath] = blobSHA(index)
+	}
+	for path, sha := range files {
+		if head.Files[path] != sha {
+			result.Changed++
+		}
+	}
+	for path := range head.Files {
+		if _, ok := files[path]; !ok {
+			result.Changed++
+		}
+	}
+	if result.Changed == 0 {
+		return nil, fmt.Errorf("the branch already matches %.7s", target.Commit)
+	}
+
+	// A tree without base lists every file, which drops the ones missing
+	// from the target.
+	var t Tree
+	for path, sha := range files {
+		entry := TreeEntry{Path: path, Mode: "100644", Type: "blob", SHA: sha}
+		if path == videoIndexPath {
+			entry.SHA, entry.Content = "", string(index)
+		}
+		t.Entries = append(t.Entries, entry)
+	}
+	sort.Slice(t.Entries, func(i, j int) bool { return t.Entries[i].Path < t.Entries[j].Path })
+	tree, err := b.createTree(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	message := rollbackMessage(target.Commit, result.Date, categories, reason)
+	if result.Commit, err = b.createCommit(ctx, message, tree, head.Commit); err != nil {
+		return nil, err
+	}
+	if err := b.updateRefs(ctx, result.Commit); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// rollbackIndex builds videos/index.json for a rollback to target, nil
+// when neither head nor target has one. The memberships of the playlists
+// of categories, all of them when empty, come from target, the others
+// from the index of head.
+func rollbackIndex(ctx context.Context, b *githubBackend, head, target *Snapshot, categories []string) ([]byte, error) {
+	if len(categories) == 0 {
+		if _, ok := target.Files[videoIndexPath]; !ok {
+			return nil, nil
+		}
+		return b.ReadFile(ctx, target, videoIndexPath)
+	}
+	if _, ok := head.Files[videoIndexPath]; !ok {
+		return nil, nil
+	}
+	content, err := b.ReadFile(ctx, head, videoIndexPath)
+	if err != nil {
+		return nil, err
+	}
+	var old VideoIndex
+	if err := json.Unmarshal(content, &old); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", videoIndexPath, err)
+	}
+	restored := map[string]bool{}
+	for _, category := range categories {
+		restored[category] = true
+	}
+	index := VideoIndex{Videos: map[string]*IndexedVideo{}}
+	for _, v := range old.Videos {
+		for _, m := range v.Memberships {
+			if !restored[m.Category] {
+				index.add(m, Video{Id: v.Id, Title: v.Title, Thumbnail: v.Thumbnail, Position: m.Position})
+			}
+		}
+	}
+	for _, category := range categories {
+		playlists, _, err := readFeed(ctx, b, target, category)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range playlists {
+			path := playlistPath(category, p.Title)
+			f, err := readPlaylist(ctx, b, target, path)
+			if err != nil {
+				return nil, err
+			}
+			if f == nil {
+				continue
+			}
+			for _, v := range f.Videos {
+				index.add(Membership{Category: category, Playlist: p.Id, Title: p.Title, Path: path}, v)
+			}
+		}
+	}
+	return json.MarshalIndent(index, "", "  ")
+}
+
+// rollbackMessage explains which backup a rollback restores.
+func rollbackMessage(target string, date time.Time, categories []string, reason string) string {
+	scope := "playlists"
+	if len(categories) > 0 {
+		scope = strings.Join(categories, ", ") + " playlists"
+	}
+	message := fmt.Sprintf("rolling back %s to %.7s\n\nRestores the %s of the backup %s made on %s.",
+		scope, target, scope, target, date.UTC().Format(time.RFC3339))
+	if reason != "" {
+		message += "\n\n" + reason
+	}
+	return message
+}
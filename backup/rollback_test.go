@@ -0,0 +1,95 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRollback(t *testing.T) {
+	env, commits := historyEnv(t)
+	files := env.github.Files(commits[2])
+	files[failuresPath] = `[{"category":"topic","playlist":"PLgone","title":"Gone","count":3,"issue":7}]`
+	latest := env.github.SetFiles("master", "failures", files)
+	result, err := env.app.Rollback(context.Background(), "2025-03-01", "the floods feed was truncated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := env.github.Head("master")
+	if result.Commit != head.SHA || result.Target != commits[0] || result.Changed == 0 {
+		t.Errorf("result = %+v", result)
+	}
+	if len(head.Parents) != 1 || head.Parents[0] != latest {
+		t.Errorf("rollback parents = %v, want %s", head.Parents, latest)
+	}
+	// The state of the runs is kept.
+	want := env.github.Files(commits[0])
+	want[failuresPath] = files[failuresPath]
+	if !reflect.DeepEqual(env.github.Files(head.SHA), want) {
+		t.Error("the tree does not match the target")
+	}
+	for _, want := range []string{"rolling back playlists to " + commits[0][:7], commits[0], "the floods feed was truncated"} {
+		if !strings.Contains(head.Message, want) {
+			t.Errorf("message lacks %q:\n%s", want, head.Message)
+		}
+	}
+
+	if _, err := env.app.Rollback(context.Background(), commits[0], ""); err == nil {
+		t.Error("empty rollback committed")
+	}
+}
+
+func TestRollbackCategory(t *testing.T) {
+	env, from, to := diffEnv(t)
+	env.app.Selection.Categories = ParseList("topic")
+	result, err := env.app.Rollback(context.Background(), from, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, after, now := env.github.Files(from), env.github.Files(to), env.github.Files(result.Commit)
+	for path, content := range now {
+		want := after[path]
+		if strings.HasPrefix(path, "topic/") {
+			want = before[path]
+		}
+		if content != want && path != videoIndexPath {
+			t.Errorf("%s was not restored", path)
+		}
+	}
+	// The index has the topic playlists of the target and the others of
+	// the head.
+	memberships := func(files map[string]string, topic bool) map[string]bool {
+		t.Helper()
+		var index VideoIndex
+		if err := json.Unmarshal([]byte(files[videoIndexPath]), &index); err != nil {
+			t.Fatal(err)
+		}
+		set := map[string]bool{}
+		for _, v := range index.Videos {
+			for _, m := range v.Memberships {
+				if (m.Category == "topic") == topic {
+					set[fmt.Sprintf("%s %s %d", v.Id, m.Path, m.Position)] = true
+				}
+			}
+		}
+		return set
+	}
+	if !reflect.DeepEqual(memberships(now, true), memberships(before, true)) || !reflect.DeepEqual(memberships(now, false), memberships(after, false)) {
+		t.Errorf("%s = %s", videoIndexPath, now[videoIndexPath])
+	}
+	if reflect.DeepEqual(memberships(before, true), memberships(after, true)) {
+		t.Fatal("the topic playlists did not change")
+	}
+	if _, ok := now["topic/Earthquakes.json"]; ok {
+		t.Error("topic/Earthquakes.json was kept")
+	}
+	if _, ok := now["topic/Refugees-Migrants Emergency - Europe.json"]; !ok {
+		t.Error("the renamed playlist file was not restored")
+	}
+	if !strings.HasPrefix(env.github.Head("master").Message, "rolling back topic playlists to ") {
+		t.Errorf("message = %q", env.github.Head("master").Message)
+	}
+}
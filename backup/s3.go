@@ -0,0 +1,294 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// amzDateFormat is the timestamp of signed requests, also used to name
+// the runs in the buckets.
+const amzDateFormat = "20060102T150405Z"
+
+// latestManifest lists the blob SHAs of the files below latest/, so that
+// a run only uploads those that changed since it was last synced.
+const latestManifest = "latest.json"
+
+// s3Sink uploads the files a run changed below runs/<start>/ and keeps
+// latest/ a copy of the whole snapshot, with path-style requests which
+// MinIO and AWS both accept.
+type s3Sink struct {
+	http                 *http.Client
+	sink                 Sink
+	accessKey, secretKey string
+}
+
+func (s *s3Sink) Name() string {
+	return "s3://" + s.sink.Bucket + "/" + s.sink.Prefix
+}
+
+func (s *s3Sink) Write(ctx context.Context, run *sinkRun) error {
+	latest, err := s.manifest(ctx)
+	if err != nil {
+		return err
+	}
+	failed, total := 0, 0
+	var first error
+	fail := func(err error) {
+		failed++
+		if first == nil {
+			first = err
+		}
+	}
+	dir := "runs/" + run.Start.UTC().Format(amzDateFormat) + "/"
+	written := map[string][]byte{}
+	for _, f := range run.Changes {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if f.Delete {
+			continue
+		}
+		written[f.Path] = f.Content
+		total++
+		if err := s.put(ctx, s.sink.Prefix+dir+f.Path, f.Content); err != nil {
+			fail(err)
+		}
+	}
+	// The manifest only lists what latest/ holds, the next run retries
+	// the files that failed.
+	synced := map[string]string{}
+	for path, sha := range run.Files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if latest[path] == sha {
+			synced[path] = sha
+			continue
+		}
+		total++
+		content, ok := written[path]
+		if !ok {
+			if content, err = run.read(ctx, path); err != nil {
+				fail(err)
+				continue
+			}
+		}
+		if err := s.put(ctx, s.sink.Prefix+"latest/"+path, content); err != nil {
+			fail(err)
+			if old, ok := latest[path]; ok {
+				synced[path] = old
+			}
+			continue
+		}
+		synced[path] = sha
+	}
+	for path, sha := range latest {
+		if _, ok := run.Files[path]; ok {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		total++
+		if _, err := s.do(ctx, "DELETE", s.sink.Prefix+"latest/"+path, nil, ""); err != nil {
+			fail(err)
+			synced[path] = sha
+		}
+	}
+	manifest, err := json.Marshal(synced)
+	if err != nil {
+		return err
+	}
+	total++
+	if err := s.put(ctx, s.sink.Prefix+latestManifest, manifest); err != nil {
+		fail(err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d uploads failed, first: %s", failed, total, first)
+	}
+	return nil
+}
+
+// manifest reads the blob SHAs of the files below latest/, none before
+// the first run.
+func (s *s3Sink) manifest(ctx context.Context) (map[string]string, error) {
+	latest := map[string]string{}
+	data, err := s.do(ctx, "GET", s.sink.Prefix+latestManifest, nil, "")
+	if hasStatus(err, http.StatusNotFound) {
+		return latest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &latest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", latestManifest, err)
+	}
+	return latest, nil
+}
+
+// Check asks for the bucket, which needs valid credentials.
+func (s *s3Sink) Check(ctx context.Context) (string, error) {
+	if _, err := s.do(ctx, "HEAD", "", nil, ""); err != nil {
+		return "", err
+	}
+	return "can reach " + s.Name(), nil
+}
+
+func (s *s3Sink) put(ctx context.Context, key string, content []byte) error {
+	_, err := s.do(ctx, "PUT", key, content, contentType(key, content))
+	return err
+}
+
+// do sends a signed request for key of the bucket, the bucket itself when
+// key is empty, and returns the body of the response.
+func (s *s3Sink) do(ctx context.Context, verb, key string, body []byte, ctype string) ([]byte, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.sink.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %s", s.sink.Endpoint, err)
+	}
+	// Send the encoding that is signed, Go would leave characters such as
+	// , + or = unescaped.
+	prefix := u.Path + "/" + s.sink.Bucket
+	raw := uriEncode(u.Path, true) + "/" + uriEncode(s.sink.Bucket, false)
+	if key != "" {
+		prefix += "/" + key
+		raw += "/" + uriEncode(key, true)
+	}
+	u.Path, u.RawPath = prefix, raw
+	req, err := http.NewRequest(verb, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("cannot make request for %s: %s", key, err)
+	}
+	if ctype != "" {
+		req.Header.Set("Content-Type", ctype)
+	}
+	signV4(req, s.accessKey, s.secretKey, s.sink.Region, "s3", hexSHA256(body), time.Now())
+	resp, err := s.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("cannot %s %s: %s", verb, u.Path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return nil, &apiError{resp.StatusCode, fmt.Sprintf("%s %s returned %s: %s", verb, u.Path, resp.Status, bytes.TrimSpace(data))}
+	}
+	return data, nil
+}
+
+// contentType describes the archived files, which are mostly JSON.
+func contentType(key string, content []byte) string {
+	switch path.Ext(key) {
+	case ".json":
+		return "application/json"
+	case ".vtt":
+		return "text/vtt; charset=utf-8"
+	}
+	return http.DetectContentType(content)
+}
+
+// signV4 signs req with AWS Signature Version 4, covering the host and
+// every header already set. The path is signed as encoded in RawPath
+// when set. payloadHash is the hex SHA-256 of the body.
+func signV4(req *http.Request, accessKey, secretKey, region, service, payloadHash string, t time.Time) {
+	amzDate := t.UTC().Format(amzDateFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		for i, v := range values {
+			values[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalURI := req.URL.RawPath
+	if canonicalURI == "" {
+		canonicalURI = req.URL.EscapedPath()
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256([]byte(canonical))
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery sorts and encodes the query parameters for signing.
+func canonicalQuery(q url.Values) string {
+	var pairs []string
+	for k, values := range q {
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(k, false)+"="+uriEncode(v, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters and,
+// in paths, the slashes.
+func uriEncode(s string, path bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', path && c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
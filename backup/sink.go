@@ -0,0 +1,127 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink receives a copy of the files of every run besides the backup
+// repository.
+type Sink struct {
+	// Type is "s3" for an S3-compatible bucket at Endpoint, by default
+	// the AWS endpoint of Region (us-east-1 by default). The objects are
+	// written below Prefix.
+	Type     string `json:"Type"`
+	Endpoint string `json:"Endpoint,omitempty"`
+	Region   string `json:"Region,omitempty"`
+	Bucket   string `json:"Bucket"`
+	Prefix   string `json:"Prefix,omitempty"`
+}
+
+// sinkWriter writes the files of a run somewhere.
+type sinkWriter interface {
+	// Name identifies the sink in summaries and preflight checks.
+	Name() string
+	// Write stores the changes of run and the snapshot of its commit.
+	Write(ctx context.Context, run *sinkRun) error
+	// Check reports whether the sink can be written to.
+	Check(ctx context.Context) (string, error)
+}
+
+// sinkRun is a committed run as the sinks see it, without the state of
+// the runs below .backup/.
+type sinkRun struct {
+	Start time.Time
+	// Changes are the files the run wrote or deleted.
+	Changes []Change
+	// Files are the blob SHAs of every file of the commit, read returns
+	// the content of those the run left unchanged.
+	Files map[string]string
+	read  func(ctx context.Context, path string) ([]byte, error)
+}
+
+// SinkResult describes the copy of a run to one sink.
+type SinkResult struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Error string `json:"error,omitempty"`
+}
+
+func (s Sink) validate() error {
+	if s.Type != "s3" {
+		return fmt.Errorf("unknown sink type %q", s.Type)
+	}
+	if s.Bucket == "" {
+		return fmt.Errorf("%s sink without Bucket", s.Type)
+	}
+	return nil
+}
+
+// sinks builds the writers of the configured sinks, with the credentials
+// set on the App.
+func (a *App) sinks() []sinkWriter {
+	var writers []sinkWriter
+	for _, s := range a.Config.Sinks {
+		writers = append(writers, &s3Sink{
+			http:      a.HTTPClient,
+			sink:      s,
+			accessKey: a.S3AccessKey,
+			secretKey: a.S3SecretKey,
+		})
+	}
+	return writers
+}
+
+// sinkRun describes the run committed on top of a.head to the sinks.
+func (a *App) sinkRun(start time.Time) *sinkRun {
+	head := a.head
+	run := &sinkRun{Start: start, Files: map[string]string{}, read: func(ctx context.Context, path string) ([]byte, error) {
+		return a.backend.ReadFile(ctx, head, path)
+	}}
+	for path, sha := range head.Files {
+		if !strings.HasPrefix(path, runStateDir) {
+			run.Files[path] = sha
+		}
+	}
+	for _, c := range a.changes {
+		if strings.HasPrefix(c.Path, runStateDir) {
+			continue
+		}
+		run.Changes = append(run.Changes, c)
+		if c.Delete {
+			delete(run.Files, c.Path)
+		} else {
+			run.Files[c.Path] = blobSHA(c.Content)
+		}
+	}
+	return run
+}
+
+// writeSinks fans the committed run out to every sink at once and records
+// the results in s.
+func (a *App) writeSinks(ctx context.Context, s *Summary) {
+	writers := a.sinks()
+	if len(writers) == 0 {
+		return
+	}
+	run := a.sinkRun(s.Start)
+	results := make([]SinkResult, len(writers))
+	var wg sync.WaitGroup
+	for i, w := range writers {
+		wg.Add(1)
+		go func(i int, w sinkWriter) {
+			defer wg.Done()
+			results[i] = SinkResult{Name: w.Name(), Files: len(run.Changes)}
+			if err := w.Write(ctx, run); err != nil {
+				log.Printf("cannot write to %s: %s\n", w.Name(), err)
+				results[i].Error = err.Error()
+			}
+		}(i, w)
+	}
+	wg.Wait()
+	s.Sinks = results
+}
@@ -0,0 +1,90 @@
+package backup
+
+import "time"
+
+// Summary describes the outcome of a run.
+type Summary struct {
+	Start      time.Time          `json:"start"`
+	End        time.Time          `json:"end"`
+	Categories []*CategorySummary `json:"categories"`
+	// CommitResult is "created", "empty" when there was nothing to
+	// commit, or "failed".
+	CommitResult string `json:"commitResult"`
+	Commit       string `json:"commit,omitempty"`
+	Error        string `json:"error,omitempty"`
+	// CacheHits are the requests answered from the response cache, which
+	// saved QuotaSaved YouTube quota units.
+	CacheHits  int64 `json:"cacheHits,omitempty"`
+	QuotaSaved int64 `json:"quotaSaved,omitempty"`
+	// Sinks are the copies of the files outside the repository.
+	Sinks []SinkResult `json:"sinks,omitempty"`
+	// Archive is the archive of the tree written after the commit.
+	Archive *ArchiveResult `json:"archive,omitempty"`
+}
+
+// CategorySummary describes the backup of one category.
+type CategorySummary struct {
+	Name      string `json:"name"`
+	FeedError string `json:"feedError,omitempty"`
+	Playlists int    `json:"playlists"`
+	Videos    int    `json:"videos"`
+	// Captions counts the caption tracks the run archived.
+	Captions int       `json:"captions,omitempty"`
+	Failures []Failure `json:"failures,omitempty"`
+	// Changes are the playlists that differ from their previous backup.
+	Changes []PlaylistChange `json:"changes,omitempty"`
+
+	// succeeded are the ids of the playlists backed up.
+	succeeded []string
+}
+
+// Failure is a playlist that could not be backed up.
+type Failure struct {
+	Category string `json:"category"`
+	Playlist string `json:"playlist"`
+	Title    string `json:"title"`
+	Error    string `json:"error"`
+}
+
+func (c *CategorySummary) ok() bool {
+	return c.FeedError == "" && len(c.Failures) == 0
+}
+
+// Failed reports whether anything in the run went wrong.
+func (s *Summary) Failed() bool {
+	if s.Error != "" || s.CommitResult == "failed" {
+		return true
+	}
+	for _, c := range s.Categories {
+		if !c.ok() {
+			return true
+		}
+	}
+	for _, r := range s.Sinks {
+		if r.Error != "" {
+			return true
+		}
+	}
+	if s.Archive != nil && s.Archive.Error != "" {
+		return true
+	}
+	return false
+}
+
+// Failures lists the failed playlists of every category.
+func (s *Summary) Failures() []Failure {
+	var failures []Failure
+	for _, c := range s.Categories {
+		failures = append(failures, c.Failures...)
+	}
+	return failures
+}
+
+// Changes lists the changed playlists of every category.
+func (s *Summary) Changes() []PlaylistChange {
+	var changes []PlaylistChange
+	for _, c := range s.Categories {
+		changes = append(changes, c.Changes...)
+	}
+	return changes
+}
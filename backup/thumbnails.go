@@ -0,0 +1,108 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// thumbnailSizes are the YouTube thumbnails archived, best first. The
+// larger standard and maxres images are rarely worth their size.
+var thumbnailSizes = []string{"high", "medium", "default"}
+
+// imageExtensions maps the sniffed content types to file extensions,
+// anything else is not archived.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// bestThumbnail picks the url of the archived size.
+func bestThumbnail(thumbnails map[string]Thumbnail) string {
+	for _, size := range thumbnailSizes {
+		if t, ok := thumbnails[size]; ok && t.Url != "" {
+			return t.Url
+		}
+	}
+	return ""
+}
+
+// archiveThumbnails stores the default image of p and the thumbnails of
+// videos, setting their Thumbnail paths, and returns the path of the
+// default image. A missing image is no reason to fail the backup, so
+// errors are only logged and leave the path empty.
+func (a *App) archiveThumbnails(ctx context.Context, p Playlist, videos []Video) string {
+	store := func(u string) string {
+		if u == "" {
+			return ""
+		}
+		path, err := a.archiveImage(ctx, u)
+		if err != nil {
+			log.Printf("cannot archive %s: %s\n", u, err)
+		}
+		return path
+	}
+	for i := range videos {
+		videos[i].Thumbnail = store(videos[i].thumbnailURL)
+	}
+	return store(p.DefaultImg)
+}
+
+// archiveImage downloads the image at u and adds it to the tree under
+// thumbnails/, named after the SHA-256 of its content so an image shared
+// by several playlists or runs is stored once.
+func (a *App) archiveImage(ctx context.Context, u string) (string, error) {
+	if path, ok := a.thumbnails[u]; ok {
+		return path, nil
+	}
+	data, err := a.downloadImage(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	ext, ok := imageExtensions[http.DetectContentType(data)]
+	if !ok {
+		return "", fmt.Errorf("not an image: %s", http.DetectContentType(data))
+	}
+	path := fmt.Sprintf("thumbnails/%x%s", sha256.Sum256(data), ext)
+	if _, ok := a.head.Files[path]; !ok && !a.thumbnailPaths[path] {
+		a.addToTree(path, string(data))
+		a.thumbnailPaths[path] = true
+	}
+	a.thumbnails[u] = path
+	return path, nil
+}
+
+// downloadImage reads the image at u, refusing anything over
+// Config.ThumbnailMaxBytes.
+func (a *App) downloadImage(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", u, resp.Status)
+	}
+	max := a.Config.ThumbnailMaxBytes
+	if resp.ContentLength > max {
+		return nil, fmt.Errorf("%d bytes, over the %d bytes limit", resp.ContentLength, max)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("over the %d bytes limit", max)
+	}
+	return data, nil
+}
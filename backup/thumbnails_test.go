@@ -0,0 +1,93 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rwapps/video_gists/internal/fake"
+)
+
+func TestRunArchivesThumbnails(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n" + strings.Repeat("x", 100))
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/shared.png":
+			w.Write(png)
+		case "/huge.png":
+			w.Write(append(png, bytes.Repeat([]byte("x"), 1000)...))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer images.Close()
+
+	env := newTestEnv(t)
+	env.app.Config.Thumbnails = true
+	env.app.Config.ThumbnailMaxBytes = 500
+	env.reliefweb.SetFeed("topic", fmt.Sprintf(`[{"title": "Floods", "id": "PLfloods", "defaultImg": %q}]`, images.URL+"/shared.png"))
+	env.youtube.SetPlaylist("PLfloods", []fake.Video{
+		{Id: "a", Title: "A", Thumbnail: images.URL + "/shared.png"},
+		{Id: "b", Title: "B", Thumbnail: images.URL + "/huge.png"},
+		{Id: "c", Title: "C", Thumbnail: images.URL + "/missing.png"},
+	})
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	files := env.github.Files(env.github.Head("master").SHA)
+	path := fmt.Sprintf("thumbnails/%x.png", sha256.Sum256(png))
+	if files[path] != string(png) {
+		t.Fatalf("%s not archived", path)
+	}
+	var thumbnails int
+	for p := range files {
+		if strings.HasPrefix(p, "thumbnails/") {
+			thumbnails++
+		}
+	}
+	if thumbnails != 1 {
+		t.Errorf("archived %d thumbnails, want 1", thumbnails)
+	}
+	var f PlaylistFile
+	if err := json.Unmarshal([]byte(files["topic/Floods.json"]), &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.DefaultImgFile != path {
+		t.Errorf("defaultImgFile = %q, want %q", f.DefaultImgFile, path)
+	}
+	want := []string{path, "", ""}
+	for i, v := range f.Videos {
+		if v.Thumbnail != want[i] {
+			t.Errorf("video %s thumbnail = %q, want %q", v.Id, v.Thumbnail, want[i])
+		}
+	}
+	if n := env.github.Requests["POST /repos/rwapps/video_backups/git/blobs"]; n != 1 {
+		t.Errorf("uploaded %d blobs, want 1", n)
+	}
+
+	// The next run finds the image in the base tree.
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.github.Requests["POST /repos/rwapps/video_backups/git/blobs"]; n != 1 {
+		t.Errorf("uploaded %d blobs after two runs, want 1", n)
+	}
+}
+
+func TestRunWithoutThumbnails(t *testing.T) {
+	env := newTestEnv(t)
+	if err := env.app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	files := env.github.Files(env.github.Head("master").SHA)
+	if strings.Contains(files["topic/Floods.json"], "thumbnail") || strings.Contains(files["topic/Floods.json"], "defaultImgFile") {
+		t.Errorf("thumbnails referenced while disabled: %s", files["topic/Floods.json"])
+	}
+}
@@ -0,0 +1,106 @@
+package backup
+
+import "encoding/json"
+
+// Ah: https://godoc.org/github.com/google/go-github/github
+// Github API structs.
+type Url struct {
+	Url string `json:"url"`
+}
+
+type SHA struct {
+	SHA string `json:"sha"`
+}
+
+type Tree struct {
+	BaseTree string      `json:"base_tree,omitempty"`
+	SHA      string      `json:"sha,omitempty"`
+	Entries  []TreeEntry `json:"tree,omitempty"`
+}
+
+type TreeEntry struct {
+	SHA     string `json:"sha,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Mode    string `json:"mode,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Size    string `json:"size,omitempty"`
+	Content string `json:"content,omitempty"`
+	// Delete removes Path from the base tree.
+	Delete bool `json:"-"`
+}
+
+// MarshalJSON sends deleted entries with the null sha the API expects.
+func (e TreeEntry) MarshalJSON() ([]byte, error) {
+	type entry TreeEntry
+	if !e.Delete {
+		return json.Marshal(entry(e))
+	}
+	return json.Marshal(map[string]interface{}{"path": e.Path, "mode": e.Mode, "type": e.Type, "sha": nil})
+}
+
+type GitObject struct {
+	Url string `json:"url"`
+	SHA string `json:"sha"`
+}
+
+type GithubRefResult struct {
+	Object GitObject `json:"object"`
+}
+
+// Youtube
+type YoutubeResult struct {
+	NextPageToken string   `json:"nextPageToken"`
+	PageInfo      PageInfo `json:"pageInfo"`
+	Items         []Item   `json:"items"`
+}
+
+type PageInfo struct {
+	TotalResults int `json:"totalResults"`
+}
+
+type Item struct {
+	Snippet Snippet `json:"snippet"`
+}
+
+type Snippet struct {
+	Title      string               `json:"title"`
+	Position   int                  `json:"position"`
+	ResourceId ResourceId           `json:"resourceId"`
+	Thumbnails map[string]Thumbnail `json:"thumbnails"`
+}
+
+type Thumbnail struct {
+	Url string `json:"url"`
+}
+
+type ResourceId struct {
+	VideoId string `json:"videoId"`
+}
+
+type Video struct {
+	Title    string `json:"title"`
+	Position int    `json:"position"`
+	Id       string `json:"id"`
+	// Thumbnail is the path of the archived thumbnail in the backup
+	// repository.
+	Thumbnail string `json:"thumbnail,omitempty"`
+	// FirstSeen and LastSeen are the dates of the first and latest
+	// backups listing the video.
+	FirstSeen string `json:"firstSeen,omitempty"`
+	LastSeen  string `json:"lastSeen,omitempty"`
+
+	thumbnailURL string
+}
+
+// RW
+type Playlist struct {
+	Title      string `json:"title"`
+	Id         string `json:"id"`
+	DefaultImg string `json:"defaultImg"`
+}
+
+type OrgPlaylist struct {
+	Title      string `json:"name"`
+	Id         string `json:"playlist_id"`
+	DefaultImg string `json:"thumbnail_url"`
+}
@@ -0,0 +1,235 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// playlistPath is where the playlist file of a category lives.
+func playlistPath(category, title string) string {
+	// Sanitize filenames - stumbled on "Refugees/Migrants Emergency - Europe"
+	if strings.Contains(title, "/") {
+		title = strings.Replace(title, "/", "-", -1)
+	}
+	return fmt.Sprintf("%s/%s.json", category, title)
+}
+
+// previousPath is the path of the previous backup of p, which has the
+// title of the archived feed when the playlist was renamed since.
+func (a *App) previousPath(ctx context.Context, category string, p Playlist) string {
+	path := playlistPath(category, p.Title)
+	if _, ok := a.head.Files[path]; ok {
+		return path
+	}
+	archived, ok := a.baseFeeds[category]
+	if !ok {
+		var err error
+		if archived, _, err = readFeed(ctx, a.backend, a.head, category); err != nil {
+			log.Printf("cannot read the archived %s feed: %s\n", category, err)
+		}
+		a.baseFeeds[category] = archived
+	}
+	for _, old := range archived {
+		if old.Id == p.Id {
+			return playlistPath(category, old.Title)
+		}
+	}
+	return path
+}
+
+func (a *App) backupPlaylists(ctx context.Context, cs *CategorySummary, playlists []Playlist) {
+	category := cs.Name
+	for _, p := range playlists {
+		if !a.Selection.includesPlaylist(p) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		fail := func(err error) {
+			log.Printf("failed to back up %s: %s\n", p.Id, err)
+			cs.Failures = append(cs.Failures, Failure{Category: category, Playlist: p.Id, Title: p.Title, Error: err.Error()})
+		}
+		videos, err := a.getVideos(ctx, p.Id)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		var imgFile string
+		if a.Config.Thumbnails {
+			imgFile = a.archiveThumbnails(ctx, p, videos)
+		}
+		path := playlistPath(category, p.Title)
+		// Without the previous backup the dates and removed videos it
+		// carries would be lost.
+		previousPath := a.previousPath(ctx, category, p)
+		previous, err := a.readBasePlaylist(ctx, previousPath)
+		if err != nil {
+			fail(fmt.Errorf("cannot read the previous backup: %s", err))
+			continue
+		}
+		removed := trackSeen(previous, videos, a.day)
+		content, err := json.Marshal(videos)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		cs.Playlists++
+		cs.Videos += len(videos)
+		cs.succeeded = append(cs.succeeded, p.Id)
+		a.recordChanges(cs, p, previous, videos)
+		if a.Config.Captions {
+			a.archiveCaptions(ctx, cs, path, videos)
+		}
+		output := fmt.Sprintf("{ \"defaultImg\": %q, ", p.DefaultImg)
+		if imgFile != "" {
+			output += fmt.Sprintf("\"defaultImgFile\": %q, ", imgFile)
+		}
+		output += fmt.Sprintf("\"videos\": %s", content)
+		if len(removed) > 0 {
+			removedContent, err := json.Marshal(removed)
+			if err != nil {
+				fail(err)
+				continue
+			}
+			output += fmt.Sprintf(", \"removed\": %s", removedContent)
+		}
+		a.addToTree(path, output+" }")
+		a.backedUp[path] = videos
+		if previousPath != path {
+			a.moveRenamed(ctx, previousPath, path)
+		}
+	}
+}
+
+// moveRenamed removes the playlist file at old, backed up before the
+// playlist was renamed to the title of path, and moves its captions.
+func (a *App) moveRenamed(ctx context.Context, old, path string) {
+	if _, ok := a.head.Files[old]; ok {
+		a.removeFromTree(old)
+	}
+	oldDir, dir := strings.TrimSuffix(old, ".json")+"/", strings.TrimSuffix(path, ".json")+"/"
+	for p := range a.head.Files {
+		if !strings.HasPrefix(p, oldDir) || !strings.HasSuffix(p, ".vtt") {
+			continue
+		}
+		content, err := a.readBase(ctx, p)
+		if err != nil {
+			log.Printf("cannot move %s: %s\n", p, err)
+			continue
+		}
+		a.addToTree(dir+strings.TrimPrefix(p, oldDir), string(content))
+		a.removeFromTree(p)
+	}
+}
+
+// recordChanges adds the differences with the previous backup of the
+// playlist to the summary.
+func (a *App) recordChanges(cs *CategorySummary, p Playlist, previous *PlaylistFile, videos []Video) {
+	if previous == nil {
+		return
+	}
+	added, removed, unavailable := diffVideos(previous.Videos, videos)
+	if len(added) == 0 && len(removed) == 0 && len(unavailable) == 0 {
+		return
+	}
+	cs.Changes = append(cs.Changes, PlaylistChange{
+		Category:    cs.Name,
+		Playlist:    p.Id,
+		Title:       p.Title,
+		Added:       added,
+		Removed:     removed,
+		Unavailable: unavailable,
+	})
+}
+
+// getVideos fetches every page of the playlist. It gives up after
+// Config.MaxPages pages or Config.MaxItems items, or when the API hands back
+// a page token it already sent, rather than keep a partial list.
+func (a *App) getVideos(ctx context.Context, playlistId string) ([]Video, error) {
+	var items []Item
+	seen := map[string]bool{}
+	total := -1
+	pageToken := ""
+	for page := 1; ; page++ {
+		if page > a.Config.MaxPages {
+			return nil, fmt.Errorf("playlist %s has more than %d pages", playlistId, a.Config.MaxPages)
+		}
+		result, err := a.getVideosPage(ctx, playlistId, pageToken)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, result.Items...)
+		if len(items) > a.Config.MaxItems {
+			return nil, fmt.Errorf("playlist %s has more than %d items", playlistId, a.Config.MaxItems)
+		}
+		if total < 0 {
+			total = result.PageInfo.TotalResults
+		}
+		if result.NextPageToken == "" {
+			break
+		}
+		if seen[result.NextPageToken] {
+			return nil, fmt.Errorf("playlist %s repeated page token %q", playlistId, result.NextPageToken)
+		}
+		seen[result.NextPageToken] = true
+		pageToken = result.NextPageToken
+	}
+	// The total can move if the playlist is edited during the run, so a
+	// mismatch is only worth a warning.
+	if total >= 0 && total != len(items) {
+		log.Printf("playlist %s: got %d items, pageInfo.totalResults is %d\n", playlistId, len(items), total)
+	}
+
+	videos := make([]Video, 0, len(items))
+	for _, vid := range items {
+		v := Video{}
+		v.Title = vid.Snippet.Title
+		v.Position = vid.Snippet.Position
+		v.Id = vid.Snippet.ResourceId.VideoId
+		v.thumbnailURL = bestThumbnail(vid.Snippet.Thumbnails)
+		videos = append(videos, v)
+	}
+	return videos, nil
+}
+
+func (a *App) getVideosPage(ctx context.Context, playlistId, pageToken string) (YoutubeResult, error) {
+	result := YoutubeResult{}
+	u, err := url.Parse(a.Config.YoutubeURL + "/playlistItems")
+	if err != nil {
+		return result, fmt.Errorf("couldn't parse api url: %s", err)
+	}
+	q := u.Query()
+	q.Set("part", "snippet")
+	q.Set("maxResults", "50")
+	fields := "nextPageToken,pageInfo/totalResults,items/snippet(position,title,resourceId/videoId)"
+	if a.Config.Thumbnails {
+		fields = "nextPageToken,pageInfo/totalResults,items/snippet(position,title,resourceId/videoId,thumbnails)"
+	}
+	q.Set("fields", fields)
+	q.Set("playlistId", playlistId)
+	q.Set("key", a.YoutubeAPIKey)
+	q.Set("pageToken", pageToken)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return result, err
+	}
+	resp, err := a.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return result, fmt.Errorf("failed to get from gapis %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("gapis returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, fmt.Errorf("failed to decode resp.Body %s", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,77 @@
+package backup
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestGetVideosPagination(t *testing.T) {
+	env := newTestEnv(t)
+	env.youtube.PageSize = 2
+
+	videos, err := env.app.getVideos(context.Background(), "PLfloods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(videos) != 7 {
+		t.Fatalf("got %d videos, want 7", len(videos))
+	}
+	if got := env.youtube.Requests["/playlistItems"]; got != 4 {
+		t.Errorf("made %d requests, want 4", got)
+	}
+	if videos[6].Id != "flood6" || videos[6].Position != 6 {
+		t.Errorf("last video = %+v", videos[6])
+	}
+}
+
+func TestGetVideosLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxPages int
+		maxItems int
+		want     string
+	}{
+		{"pages", 3, 5000, "more than 3 pages"},
+		{"items", 100, 5, "more than 5 items"},
+		{"exact", 4, 7, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.youtube.PageSize = 2
+			env.app.Config.MaxPages = tt.maxPages
+			env.app.Config.MaxItems = tt.maxItems
+			_, err := env.app.getVideos(context.Background(), "PLfloods")
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetVideosRepeatedToken(t *testing.T) {
+	env := newTestEnv(t)
+	env.youtube.PageSize = 2
+	env.youtube.RepeatToken = true
+	_, err := env.app.getVideos(context.Background(), "PLfloods")
+	if err == nil || !strings.Contains(err.Error(), "repeated page token") {
+		t.Errorf("err = %v, want a repeated token error", err)
+	}
+	if got := env.youtube.Requests["/playlistItems"]; got != 2 {
+		t.Errorf("made %d requests, want 2", got)
+	}
+}
+
+func TestGetVideosUnknownPlaylist(t *testing.T) {
+	env := newTestEnv(t)
+	if _, err := env.app.getVideos(context.Background(), "PLmissing"); err == nil {
+		t.Error("expected an error for a missing playlist")
+	}
+}
@@ -0,0 +1,209 @@
+package fake
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Gitea serves the repository endpoints of the Gitea API for a single
+// repository below /api/v1.
+type Gitea struct {
+	*httptest.Server
+	Owner, Repo string
+	// Token, when set, is required as "token" or bearer authorization.
+	Token string
+	// Push is the push permission of the token user, true by default.
+	Push bool
+	// PageSize, when set, caps per_page to force pagination.
+	PageSize int
+
+	mu    sync.Mutex
+	store *store
+	// Requests counts the requests per "METHOD path" below the repository.
+	Requests map[string]int
+}
+
+// NewGitea starts a fake holding files on branch of owner/repo.
+func NewGitea(owner, repo, branch string, files map[string]string) *Gitea {
+	g := &Gitea{Owner: owner, Repo: repo, Push: true, store: newStore(branch, files), Requests: map[string]int{}}
+	g.Server = httptest.NewServer(http.HandlerFunc(g.serve))
+	return g
+}
+
+// Head returns the commit the branch points at.
+func (g *Gitea) Head() *Commit {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c := g.store.commits[g.store.head].Commit
+	return &c
+}
+
+// Files returns the files of the branch.
+func (g *Gitea) Files() map[string]string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.store.headFiles()
+}
+
+// SetFiles commits files on top of the branch, replacing every file.
+func (g *Gitea) SetFiles(message string, files map[string]string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.store.commit(message, files)
+}
+
+// giteaError writes the error body of the Gitea API.
+func giteaError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
+
+func (g *Gitea) serve(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Token != "" {
+		auth := r.Header.Get("Authorization")
+		if auth != "token "+g.Token && auth != "Bearer "+g.Token {
+			giteaError(w, http.StatusUnauthorized, "token is required")
+			return
+		}
+	}
+	prefix := fmt.Sprintf("/api/v1/repos/%s/%s", g.Owner, g.Repo)
+	if r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/") {
+		giteaError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+	path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	g.Requests[r.Method+" "+path]++
+	switch {
+	case path == "" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"full_name":   g.Owner + "/" + g.Repo,
+			"permissions": map[string]bool{"admin": false, "push": g.Push, "pull": true},
+		})
+	case strings.HasPrefix(path, "branches/") && r.Method == "GET":
+		if strings.TrimPrefix(path, "branches/") != g.store.branch {
+			giteaError(w, http.StatusNotFound, "branch not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"name": g.store.branch, "commit": map[string]string{"id": g.store.head}})
+	case strings.HasPrefix(path, "git/trees/") && r.Method == "GET":
+		g.tree(w, r, strings.TrimPrefix(path, "git/trees/"))
+	case strings.HasPrefix(path, "git/blobs/") && r.Method == "GET":
+		sha := strings.TrimPrefix(path, "git/blobs/")
+		content, ok := g.store.blobs[sha]
+		if !ok {
+			giteaError(w, http.StatusNotFound, "blob not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"sha":      sha,
+			"size":     len(content),
+			"encoding": "base64",
+			"content":  base64.StdEncoding.EncodeToString([]byte(content)),
+		})
+	case path == "contents" && r.Method == "POST":
+		g.changeFiles(w, r)
+	default:
+		giteaError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// tree lists the tree of a commit page by page, with the total count of
+// entries.
+func (g *Gitea) tree(w http.ResponseWriter, r *http.Request, sha string) {
+	entries, ok := g.store.entries(sha)
+	if !ok {
+		giteaError(w, http.StatusNotFound, "sha not found")
+		return
+	}
+	q := r.URL.Query()
+	size, err := strconv.Atoi(q.Get("per_page"))
+	if err != nil || size <= 0 {
+		size = 1000
+	}
+	if g.PageSize > 0 && size > g.PageSize {
+		size = g.PageSize
+	}
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	start, end := (page-1)*size, page*size
+	if start > len(entries) {
+		start = len(entries)
+	}
+	if end > len(entries) {
+		end = len(entries)
+	}
+	items := []map[string]string{}
+	for _, e := range entries[start:end] {
+		items = append(items, map[string]string{"path": e.Path, "type": e.Type, "sha": e.SHA, "mode": "100644"})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sha":         g.store.commits[sha].Tree,
+		"tree":        items,
+		"truncated":   end < len(entries),
+		"page":        page,
+		"total_count": len(entries),
+	})
+}
+
+// changeFiles applies the file operations in one commit, checking the SHA
+// of updated files.
+func (g *Gitea) changeFiles(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Branch  string `json:"branch"`
+		Message string `json:"message"`
+		Files   []struct {
+			Operation string `json:"operation"`
+			Path      string `json:"path"`
+			Content   string `json:"content"`
+			SHA       string `json:"sha"`
+		} `json:"files"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		giteaError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Branch != g.store.branch {
+		giteaError(w, http.StatusNotFound, "branch not found")
+		return
+	}
+	files := g.store.headFiles()
+	for _, f := range req.Files {
+		content, err := base64.StdEncoding.DecodeString(f.Content)
+		if err != nil {
+			giteaError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		current, exists := files[f.Path]
+		switch {
+		case f.Operation == "create" && exists:
+			giteaError(w, http.StatusUnprocessableEntity, "repository file already exists ["+f.Path+"]")
+			return
+		case (f.Operation == "update" || f.Operation == "delete") && !exists:
+			giteaError(w, http.StatusNotFound, "repository file does not exist ["+f.Path+"]")
+			return
+		case (f.Operation == "update" || f.Operation == "delete") && f.SHA != hash("blob", current):
+			giteaError(w, http.StatusConflict, "sha does not match ["+f.SHA+"]")
+			return
+		case f.Operation == "delete":
+			delete(files, f.Path)
+		case f.Operation == "create" || f.Operation == "update":
+			files[f.Path] = string(content)
+		default:
+			giteaError(w, http.StatusUnprocessableEntity, "unknown operation "+f.Operation)
+			return
+		}
+	}
+	sha := g.store.commit(req.Message, files)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"commit": map[string]interface{}{"sha": sha, "message": req.Message},
+	})
+}
@@ -0,0 +1,749 @@
+package fake
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitHub is an in-memory Git Data API for a single repository. Trees are
+// kept flat, keyed by full path, which is all the backup ever needs.
+type GitHub struct {
+	*httptest.Server
+	Owner string
+	Repo  string
+
+	// Now dates new commits, it defaults to time.Now.
+	Now func() time.Time
+	// Token, when set, is required on every request. Login and Permission
+	// describe its user, the permission defaults to "write".
+	Token      string
+	Login      string
+	Permission string
+	// TruncateTrees, when set, caps the entries of recursive tree
+	// listings, flagged truncated as GitHub does for large trees.
+	TruncateTrees int
+
+	mu      sync.Mutex
+	blobs   map[string]string
+	trees   map[string]map[string]string // tree sha -> path -> blob sha
+	commits map[string]*Commit
+	refs    map[string]string
+	issues  []*Issue
+	// releases are numbered from 1 like issues, nextRelease is the
+	// number of the next one as they can be deleted.
+	releases    []*Release
+	nextRelease int
+	// Requests counts the requests per "METHOD path".
+	Requests map[string]int
+}
+
+// Commit is a stored commit.
+type Commit struct {
+	SHA     string
+	Message string
+	Tree    string
+	Parents []string
+	Date    time.Time
+}
+
+// Issue is a stored issue.
+type Issue struct {
+	Number   int
+	Title    string
+	Body     string
+	State    string
+	Labels   []string
+	Comments []string
+}
+
+type treeEntry struct {
+	Path    string  `json:"path"`
+	Mode    string  `json:"mode,omitempty"`
+	Type    string  `json:"type,omitempty"`
+	SHA     *string `json:"sha,omitempty"`
+	Content *string `json:"content,omitempty"`
+	Size    int     `json:"size,omitempty"`
+}
+
+// NewGitHub starts a fake holding owner/repo with branch pointing at an
+// initial commit of files.
+func NewGitHub(owner, repo, branch string, files map[string]string) *GitHub {
+	g := &GitHub{
+		Owner:       owner,
+		Repo:        repo,
+		Now:         time.Now,
+		Login:       "backup-bot",
+		Permission:  "write",
+		blobs:       map[string]string{},
+		trees:       map[string]map[string]string{},
+		commits:     map[string]*Commit{},
+		refs:        map[string]string{},
+		Requests:    map[string]int{},
+		nextRelease: 1,
+	}
+	tree := map[string]string{}
+	for path, content := range files {
+		tree[path] = g.putBlob(content)
+	}
+	g.refs["heads/"+branch] = g.putCommit("initial", g.putTree(tree), nil)
+	g.Server = httptest.NewServer(http.HandlerFunc(g.serve))
+	return g
+}
+
+func hash(kind, content string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("%s %d\x00%s", kind, len(content), content))))
+}
+
+func (g *GitHub) putBlob(content string) string {
+	sha := hash("blob", content)
+	g.blobs[sha] = content
+	return sha
+}
+
+func (g *GitHub) putTree(tree map[string]string) string {
+	var paths []string
+	for p := range tree {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var b strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s %s\n", p, tree[p])
+	}
+	sha := hash("tree", b.String())
+	g.trees[sha] = tree
+	return sha
+}
+
+func (g *GitHub) putCommit(message, tree string, parents []string) string {
+	date := g.Now().UTC().Truncate(time.Second)
+	sha := hash("commit", fmt.Sprintf("%s\n%s\n%v\n%s\n%d", tree, message, parents, date, len(g.commits)))
+	g.commits[sha] = &Commit{SHA: sha, Message: message, Tree: tree, Parents: parents, Date: date}
+	return sha
+}
+
+// Head returns the commit the branch points at.
+func (g *GitHub) Head(branch string) *Commit {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.commits[g.refs["heads/"+branch]]
+}
+
+// Files returns the content of every file in the tree of commit sha.
+func (g *GitHub) Files(sha string) map[string]string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	files := map[string]string{}
+	c := g.commits[sha]
+	if c == nil {
+		return files
+	}
+	for path, blob := range g.trees[c.Tree] {
+		files[path] = g.blobs[blob]
+	}
+	return files
+}
+
+// SetFiles commits files on top of branch, replacing the whole tree.
+func (g *GitHub) SetFiles(branch, message string, files map[string]string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	tree := map[string]string{}
+	for path, content := range files {
+		tree[path] = g.putBlob(content)
+	}
+	sha := g.putCommit(message, g.putTree(tree), []string{g.refs["heads/"+branch]})
+	g.refs["heads/"+branch] = sha
+	return sha
+}
+
+func (g *GitHub) serve(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.Requests[r.Method+" "+r.URL.Path]++
+
+	if g.Token != "" {
+		auth := r.Header.Get("Authorization")
+		if auth != "token "+g.Token && auth != "Bearer "+g.Token {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Bad credentials"})
+			return
+		}
+	}
+	if r.URL.Path == "/user" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"login": g.Login})
+		return
+	}
+	prefix := fmt.Sprintf("/repos/%s/%s/", g.Owner, g.Repo)
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.NotFound(w, r)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	switch {
+	case strings.HasPrefix(path, "collaborators/") && strings.HasSuffix(path, "/permission"):
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"permission": g.Permission,
+			"user":       map[string]string{"login": strings.Split(path, "/")[1]},
+		})
+	case strings.HasPrefix(path, "git/refs/"):
+		g.serveRef(w, r, strings.TrimPrefix(path, "git/refs/"))
+	case path == "issues" || strings.HasPrefix(path, "issues/"):
+		g.serveIssues(w, r, strings.TrimPrefix(strings.TrimPrefix(path, "issues"), "/"))
+	case path == "releases" || strings.HasPrefix(path, "releases/"):
+		g.serveReleases(w, r, strings.TrimPrefix(strings.TrimPrefix(path, "releases"), "/"))
+	case path == "git/trees" && r.Method == "POST":
+		g.createTree(w, r)
+	case strings.HasPrefix(path, "git/trees/") && r.Method == "GET":
+		g.getTree(w, r, strings.TrimPrefix(path, "git/trees/"))
+	case path == "git/blobs" && r.Method == "POST":
+		g.createBlob(w, r)
+	case strings.HasPrefix(path, "git/blobs/") && r.Method == "GET":
+		g.getBlob(w, r, strings.TrimPrefix(path, "git/blobs/"))
+	case path == "git/commits" && r.Method == "POST":
+		g.createCommit(w, r)
+	case strings.HasPrefix(path, "git/commits/") && r.Method == "GET":
+		g.getGitCommit(w, r, strings.TrimPrefix(path, "git/commits/"))
+	case strings.HasPrefix(path, "contents/") && r.Method == "GET":
+		g.getContents(w, r, strings.TrimPrefix(path, "contents/"))
+	case path == "commits" && r.Method == "GET":
+		g.listCommits(w, r)
+	case strings.HasPrefix(path, "commits/") && r.Method == "GET":
+		g.getRepoCommit(w, r, strings.TrimPrefix(path, "commits/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (g *GitHub) serveRef(w http.ResponseWriter, r *http.Request, ref string) {
+	switch r.Method {
+	case "GET":
+		sha, ok := g.refs[ref]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"ref":    "refs/" + ref,
+			"object": map[string]string{"type": "commit", "sha": sha},
+		})
+	case "PATCH":
+		var req struct {
+			SHA   string `json:"sha"`
+			Force bool   `json:"force"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c, ok := g.commits[req.SHA]
+		if !ok {
+			http.Error(w, "unknown commit", http.StatusUnprocessableEntity)
+			return
+		}
+		if !req.Force && !g.descends(c, g.refs[ref]) {
+			http.Error(w, "Update is not a fast forward", http.StatusUnprocessableEntity)
+			return
+		}
+		g.refs[ref] = req.SHA
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"ref":    "refs/" + ref,
+			"object": map[string]string{"type": "commit", "sha": req.SHA},
+		})
+	case "DELETE":
+		if _, ok := g.refs[ref]; !ok {
+			http.Error(w, "Reference does not exist", http.StatusUnprocessableEntity)
+			return
+		}
+		delete(g.refs, ref)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// descends reports whether c has ancestor in its history.
+func (g *GitHub) descends(c *Commit, ancestor string) bool {
+	if ancestor == "" || c.SHA == ancestor {
+		return true
+	}
+	for _, p := range c.Parents {
+		if pc, ok := g.commits[p]; ok && g.descends(pc, ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *GitHub) createTree(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		BaseTree string      `json:"base_tree"`
+		Tree     []treeEntry `json:"tree"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tree := map[string]string{}
+	if req.BaseTree != "" {
+		base, ok := g.trees[req.BaseTree]
+		if !ok {
+			http.Error(w, "unknown base_tree", http.StatusUnprocessableEntity)
+			return
+		}
+		for p, sha := range base {
+			tree[p] = sha
+		}
+	}
+	for _, e := range req.Tree {
+		switch {
+		case e.Content != nil:
+			tree[e.Path] = g.putBlob(*e.Content)
+		case e.SHA == nil:
+			delete(tree, e.Path)
+		default:
+			if _, ok := g.blobs[*e.SHA]; !ok {
+				http.Error(w, "unknown blob "+*e.SHA, http.StatusUnprocessableEntity)
+				return
+			}
+			tree[e.Path] = *e.SHA
+		}
+	}
+	sha := g.putTree(tree)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"sha": sha, "tree": g.entries(tree)})
+}
+
+// entries lists tree as the recursive Git Data API does, directories
+// included.
+func (g *GitHub) entries(tree map[string]string) []treeEntry {
+	var entries []treeEntry
+	dirs := map[string]bool{}
+	for p, sha := range tree {
+		sha := sha
+		entries = append(entries, treeEntry{Path: p, Mode: "100644", Type: "blob", SHA: &sha, Size: len(g.blobs[sha])})
+		for i := strings.LastIndex(p, "/"); i > 0; i = strings.LastIndex(p[:i], "/") {
+			dirs[p[:i]] = true
+		}
+	}
+	for d := range dirs {
+		entries = append(entries, treeEntry{Path: d, Mode: "040000", Type: "tree"})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+func (g *GitHub) getTree(w http.ResponseWriter, r *http.Request, sha string) {
+	tree, ok := g.trees[sha]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Query().Get("recursive") == "" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"sha": sha, "tree": g.topLevel(tree), "truncated": false})
+		return
+	}
+	entries := g.entries(tree)
+	truncated := g.TruncateTrees > 0 && len(entries) > g.TruncateTrees
+	if truncated {
+		entries = entries[:g.TruncateTrees]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sha": sha, "tree": entries, "truncated": truncated})
+}
+
+// topLevel lists the blobs and directories at the root of tree, each
+// directory stored as a tree of its own.
+func (g *GitHub) topLevel(tree map[string]string) []treeEntry {
+	var entries []treeEntry
+	dirs := map[string]map[string]string{}
+	for p, sha := range tree {
+		sha := sha
+		if i := strings.Index(p, "/"); i > 0 {
+			if dirs[p[:i]] == nil {
+				dirs[p[:i]] = map[string]string{}
+			}
+			dirs[p[:i]][p[i+1:]] = sha
+			continue
+		}
+		entries = append(entries, treeEntry{Path: p, Mode: "100644", Type: "blob", SHA: &sha, Size: len(g.blobs[sha])})
+	}
+	for d, sub := range dirs {
+		sha := g.putTree(sub)
+		entries = append(entries, treeEntry{Path: d, Mode: "040000", Type: "tree", SHA: &sha})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+func (g *GitHub) createBlob(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	content := req.Content
+	if req.Encoding == "base64" {
+		b, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content = string(b)
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"sha": g.putBlob(content)})
+}
+
+func (g *GitHub) getBlob(w http.ResponseWriter, r *http.Request, sha string) {
+	content, ok := g.blobs[sha]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sha":      sha,
+		"size":     len(content),
+		"encoding": "base64",
+		"content":  base64.StdEncoding.EncodeToString([]byte(content)),
+	})
+}
+
+func (g *GitHub) createCommit(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Message string   `json:"message"`
+		Tree    string   `json:"tree"`
+		Parents []string `json:"parents"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := g.trees[req.Tree]; !ok {
+		http.Error(w, "unknown tree", http.StatusUnprocessableEntity)
+		return
+	}
+	for _, p := range req.Parents {
+		if _, ok := g.commits[p]; !ok {
+			http.Error(w, "unknown parent "+p, http.StatusUnprocessableEntity)
+			return
+		}
+	}
+	sha := g.putCommit(req.Message, req.Tree, req.Parents)
+	writeJSON(w, http.StatusCreated, g.gitCommit(g.commits[sha]))
+}
+
+func (g *GitHub) gitCommit(c *Commit) map[string]interface{} {
+	var parents []map[string]string
+	for _, p := range c.Parents {
+		parents = append(parents, map[string]string{"sha": p})
+	}
+	author := map[string]string{"name": "backup", "date": c.Date.Format(time.RFC3339)}
+	return map[string]interface{}{
+		"sha":       c.SHA,
+		"message":   c.Message,
+		"tree":      map[string]string{"sha": c.Tree},
+		"parents":   parents,
+		"author":    author,
+		"committer": author,
+	}
+}
+
+func (g *GitHub) getGitCommit(w http.ResponseWriter, r *http.Request, sha string) {
+	c, ok := g.commits[sha]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, g.gitCommit(c))
+}
+
+// resolve finds the commit of a branch, a SHA or a unique abbreviation.
+func (g *GitHub) resolve(ref string) *Commit {
+	if sha, ok := g.refs["heads/"+ref]; ok {
+		return g.commits[sha]
+	}
+	if c, ok := g.commits[ref]; ok {
+		return c
+	}
+	var found *Commit
+	for sha, c := range g.commits {
+		if len(ref) >= 4 && strings.HasPrefix(sha, ref) {
+			if found != nil {
+				return nil
+			}
+			found = c
+		}
+	}
+	return found
+}
+
+func (g *GitHub) repoCommit(c *Commit) map[string]interface{} {
+	var parents []map[string]string
+	for _, p := range c.Parents {
+		parents = append(parents, map[string]string{"sha": p})
+	}
+	return map[string]interface{}{"sha": c.SHA, "commit": g.gitCommit(c), "parents": parents}
+}
+
+func (g *GitHub) getRepoCommit(w http.ResponseWriter, r *http.Request, ref string) {
+	c := g.resolve(ref)
+	if c == nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "No commit found for SHA: " + ref})
+		return
+	}
+	writeJSON(w, http.StatusOK, g.repoCommit(c))
+}
+
+// listCommits walks the first parents from the sha parameter, newest
+// first, keeping the commits between since and until that change path.
+func (g *GitHub) listCommits(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	ref := q.Get("sha")
+	if ref == "" {
+		ref = "master"
+	}
+	var since, until time.Time
+	for name, t := range map[string]*time.Time{"since": &since, "until": &until} {
+		if v := q.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "invalid " + name})
+				return
+			}
+			*t = parsed
+		}
+	}
+	path := q.Get("path")
+	var list []*Commit
+	for c := g.resolve(ref); c != nil; {
+		var parent *Commit
+		if len(c.Parents) > 0 {
+			parent = g.commits[c.Parents[0]]
+		}
+		inRange := (since.IsZero() || !c.Date.Before(since)) && (until.IsZero() || !c.Date.After(until))
+		if inRange && (path == "" || g.touches(c, parent, path)) {
+			list = append(list, c)
+		}
+		c = parent
+	}
+	size, err := strconv.Atoi(q.Get("per_page"))
+	if err != nil || size <= 0 {
+		size = 30
+	}
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	start, end := (page-1)*size, page*size
+	if start > len(list) {
+		start = len(list)
+	}
+	if end < len(list) {
+		next := *r.URL
+		nq := next.Query()
+		nq.Set("page", strconv.Itoa(page+1))
+		next.RawQuery = nq.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, r.Host, next.RequestURI()))
+	} else {
+		end = len(list)
+	}
+	items := []map[string]interface{}{}
+	for _, c := range list[start:end] {
+		items = append(items, g.repoCommit(c))
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// getContents returns a file of the ref parameter, the branch by
+// default, base64 encoded like GitHub.
+func (g *GitHub) getContents(w http.ResponseWriter, r *http.Request, path string) {
+	ref := r.URL.Query().Get("ref")
+	if ref == "" {
+		ref = "master"
+	}
+	c := g.resolve(ref)
+	if c == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "No commit found for the ref " + ref})
+		return
+	}
+	sha, ok := g.trees[c.Tree][path]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	content := g.blobs[sha]
+	if len(content) > 1<<20 {
+		// GitHub leaves out the content of files over 1 MB.
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"type": "file", "encoding": "none", "size": len(content), "path": path, "sha": sha, "content": "",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"type":     "file",
+		"encoding": "base64",
+		"size":     len(content),
+		"name":     path[strings.LastIndex(path, "/")+1:],
+		"path":     path,
+		"sha":      sha,
+		"content":  base64.StdEncoding.EncodeToString([]byte(content)),
+	})
+}
+
+// touches reports whether c changes the file at path, or any file below
+// it, compared to its parent.
+func (g *GitHub) touches(c, parent *Commit, path string) bool {
+	var before map[string]string
+	if parent != nil {
+		before = g.trees[parent.Tree]
+	}
+	after := g.trees[c.Tree]
+	below := func(p string) bool { return p == path || strings.HasPrefix(p, strings.TrimSuffix(path, "/")+"/") }
+	for p, sha := range after {
+		if below(p) && before[p] != sha {
+			return true
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; below(p) && !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Issues returns a copy of every issue.
+func (g *GitHub) Issues() []Issue {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var issues []Issue
+	for _, i := range g.issues {
+		issues = append(issues, *i)
+	}
+	return issues
+}
+
+func (i *Issue) json() map[string]interface{} {
+	var labels []map[string]string
+	for _, l := range i.Labels {
+		labels = append(labels, map[string]string{"name": l})
+	}
+	return map[string]interface{}{
+		"number":   i.Number,
+		"title":    i.Title,
+		"body":     i.Body,
+		"state":    i.State,
+		"labels":   labels,
+		"comments": len(i.Comments),
+	}
+}
+
+func (i *Issue) hasLabels(labels []string) bool {
+	for _, want := range labels {
+		found := false
+		for _, l := range i.Labels {
+			found = found || l == want
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// serveIssues handles the issue list, creation, edits and comments, rest
+// is the path below "issues/".
+func (g *GitHub) serveIssues(w http.ResponseWriter, r *http.Request, rest string) {
+	var req struct {
+		Title  *string   `json:"title"`
+		Body   *string   `json:"body"`
+		State  *string   `json:"state"`
+		Labels *[]string `json:"labels"`
+	}
+	if r.Method != "GET" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	parts := strings.Split(rest, "/")
+	switch {
+	case rest == "" && r.Method == "GET":
+		state := r.URL.Query().Get("state")
+		if state == "" {
+			state = "open"
+		}
+		var labels []string
+		if l := r.URL.Query().Get("labels"); l != "" {
+			labels = strings.Split(l, ",")
+		}
+		list := []map[string]interface{}{}
+		for _, i := range g.issues {
+			if (state == "all" || i.State == state) && i.hasLabels(labels) {
+				list = append(list, i.json())
+			}
+		}
+		writeJSON(w, http.StatusOK, list)
+	case rest == "" && r.Method == "POST":
+		if req.Title == nil {
+			http.Error(w, "title is required", http.StatusUnprocessableEntity)
+			return
+		}
+		i := &Issue{Number: len(g.issues) + 1, Title: *req.Title, State: "open"}
+		if req.Body != nil {
+			i.Body = *req.Body
+		}
+		if req.Labels != nil {
+			i.Labels = *req.Labels
+		}
+		g.issues = append(g.issues, i)
+		writeJSON(w, http.StatusCreated, i.json())
+	default:
+		var n int
+		if _, err := fmt.Sscan(parts[0], &n); err != nil || n < 1 || n > len(g.issues) {
+			http.NotFound(w, r)
+			return
+		}
+		i := g.issues[n-1]
+		switch {
+		case len(parts) == 1 && r.Method == "PATCH":
+			if req.Title != nil {
+				i.Title = *req.Title
+			}
+			if req.Body != nil {
+				i.Body = *req.Body
+			}
+			if req.State != nil {
+				i.State = *req.State
+			}
+			if req.Labels != nil {
+				i.Labels = *req.Labels
+			}
+			writeJSON(w, http.StatusOK, i.json())
+		case len(parts) == 2 && parts[1] == "comments" && r.Method == "POST":
+			if req.Body == nil {
+				http.Error(w, "body is required", http.StatusUnprocessableEntity)
+				return
+			}
+			i.Comments = append(i.Comments, *req.Body)
+			writeJSON(w, http.StatusCreated, map[string]interface{}{"id": len(i.Comments), "body": i.Comments[len(i.Comments)-1]})
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package fake
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GitLab serves the repository endpoints of the GitLab API for a single
+// project below /api/v4.
+type GitLab struct {
+	*httptest.Server
+	Project string
+	// Token, when set, is required as a bearer or PRIVATE-TOKEN.
+	Token string
+	// AccessLevel is the role of the token user, 40 (Maintainer) by
+	// default.
+	AccessLevel int
+	// PageSize, when set, caps per_page to force pagination.
+	PageSize int
+
+	mu    sync.Mutex
+	store *store
+	// Requests counts the requests per "METHOD path" below the project.
+	Requests map[string]int
+}
+
+// NewGitLab starts a fake holding files on branch of project "owner/repo".
+func NewGitLab(project, branch string, files map[string]string) *GitLab {
+	g := &GitLab{Project: project, AccessLevel: 40, store: newStore(branch, files), Requests: map[string]int{}}
+	g.Server = httptest.NewServer(http.HandlerFunc(g.serve))
+	return g
+}
+
+// Head returns the commit the branch points at.
+func (g *GitLab) Head() *Commit {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c := g.store.commits[g.store.head].Commit
+	return &c
+}
+
+// Files returns the files of the branch.
+func (g *GitLab) Files() map[string]string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.store.headFiles()
+}
+
+// SetFiles commits files on top of the branch, replacing every file.
+func (g *GitLab) SetFiles(message string, files map[string]string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.store.commit(message, files)
+}
+
+func (g *GitLab) serve(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Token != "" && r.Header.Get("Authorization") != "Bearer "+g.Token && r.Header.Get("PRIVATE-TOKEN") != g.Token {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "401 Unauthorized"})
+		return
+	}
+	// The project id is the url encoded path, only the escaped path keeps
+	// it whole.
+	prefix := "/api/v4/projects/" + url.PathEscape(g.Project)
+	path := r.URL.EscapedPath()
+	if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Project Not Found"})
+		return
+	}
+	path = strings.TrimPrefix(strings.TrimPrefix(path, prefix), "/")
+	g.Requests[r.Method+" "+path]++
+	switch {
+	case path == "" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"path_with_namespace": g.Project,
+			"permissions": map[string]interface{}{
+				"project_access": map[string]int{"access_level": g.AccessLevel},
+				"group_access":   nil,
+			},
+		})
+	case strings.HasPrefix(path, "repository/branches/") && r.Method == "GET":
+		branch, _ := url.PathUnescape(strings.TrimPrefix(path, "repository/branches/"))
+		if branch != g.store.branch {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Branch Not Found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"name": branch, "commit": map[string]string{"id": g.store.head}})
+	case path == "repository/tree" && r.Method == "GET":
+		g.tree(w, r)
+	case strings.HasPrefix(path, "repository/blobs/") && strings.HasSuffix(path, "/raw") && r.Method == "GET":
+		content, ok := g.store.blobs[strings.TrimSuffix(strings.TrimPrefix(path, "repository/blobs/"), "/raw")]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Blob Not Found"})
+			return
+		}
+		w.Write([]byte(content))
+	case path == "repository/commits" && r.Method == "POST":
+		g.commit(w, r)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Not Found"})
+	}
+}
+
+// tree lists the tree of ref page by page, announcing the next page in
+// X-Next-Page.
+func (g *GitLab) tree(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	ref := q.Get("ref")
+	if ref == g.store.branch {
+		ref = g.store.head
+	}
+	entries, ok := g.store.entries(ref)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Tree Not Found"})
+		return
+	}
+	size, err := strconv.Atoi(q.Get("per_page"))
+	if err != nil || size <= 0 {
+		size = 20
+	}
+	if g.PageSize > 0 && size > g.PageSize {
+		size = g.PageSize
+	}
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	start, end := (page-1)*size, page*size
+	if start > len(entries) {
+		start = len(entries)
+	}
+	if end >= len(entries) {
+		end = len(entries)
+	} else {
+		w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+	}
+	items := []map[string]string{}
+	for _, e := range entries[start:end] {
+		items = append(items, map[string]string{"id": e.SHA, "name": e.Path[strings.LastIndex(e.Path, "/")+1:], "type": e.Type, "path": e.Path, "mode": "100644"})
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+func (g *GitLab) commit(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Branch        string `json:"branch"`
+		CommitMessage string `json:"commit_message"`
+		Actions       []struct {
+			Action       string `json:"action"`
+			FilePath     string `json:"file_path"`
+			Content      string `json:"content"`
+			Encoding     string `json:"encoding"`
+			LastCommitId string `json:"last_commit_id"`
+		} `json:"actions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	if req.Branch != g.store.branch {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "You can only create or edit files when you are on a branch"})
+		return
+	}
+	files := g.store.headFiles()
+	for _, a := range req.Actions {
+		content := a.Content
+		if a.Encoding == "base64" {
+			b, err := base64.StdEncoding.DecodeString(content)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+				return
+			}
+			content = string(b)
+		}
+		_, exists := files[a.FilePath]
+		switch {
+		case a.Action == "create" && exists:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": "A file with this name already exists"})
+			return
+		case (a.Action == "update" || a.Action == "delete") && !exists:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": "A file with this name doesn't exist"})
+			return
+		case (a.Action == "update" || a.Action == "delete") && a.LastCommitId != "" && g.changedSince(a.LastCommitId, a.FilePath):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": "You are attempting to update a file that has changed since you started editing it."})
+			return
+		case a.Action == "delete":
+			delete(files, a.FilePath)
+		case a.Action == "create" || a.Action == "update":
+			files[a.FilePath] = content
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": "unknown action " + a.Action})
+			return
+		}
+	}
+	sha := g.store.commit(req.CommitMessage, files)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"id": sha, "message": req.CommitMessage})
+}
+
+// changedSince reports whether path differs at the head from commit sha.
+func (g *GitLab) changedSince(sha, path string) bool {
+	c, ok := g.store.commits[sha]
+	if !ok {
+		return true
+	}
+	before, ok := c.files[path]
+	now, exists := g.store.commits[g.store.head].files[path]
+	return !ok || !exists || before != now
+}
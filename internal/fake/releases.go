@@ -0,0 +1,146 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Release is a stored release with its assets.
+type Release struct {
+	ID      int
+	TagName string
+	Target  string
+	Name    string
+	Body    string
+	Assets  []Asset
+}
+
+// Asset is an uploaded release asset.
+type Asset struct {
+	ID          int
+	Name        string
+	ContentType string
+	Content     []byte
+}
+
+// Releases copies the releases of the repository.
+func (g *GitHub) Releases() []Release {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var releases []Release
+	for _, r := range g.releases {
+		releases = append(releases, *r)
+	}
+	return releases
+}
+
+func (r *Release) json() map[string]interface{} {
+	assets := []map[string]interface{}{}
+	for _, a := range r.Assets {
+		assets = append(assets, map[string]interface{}{"id": a.ID, "name": a.Name, "size": len(a.Content), "content_type": a.ContentType})
+	}
+	return map[string]interface{}{
+		"id":               r.ID,
+		"tag_name":         r.TagName,
+		"target_commitish": r.Target,
+		"name":             r.Name,
+		"body":             r.Body,
+		"assets":           assets,
+	}
+}
+
+// release finds the release with the id, nil if there is none.
+func (g *GitHub) release(id string) *Release {
+	for _, rel := range g.releases {
+		if fmt.Sprint(rel.ID) == id {
+			return rel
+		}
+	}
+	return nil
+}
+
+// serveReleases handles the releases below the repository, the asset
+// uploads included as the fake is also the upload host.
+func (g *GitHub) serveReleases(w http.ResponseWriter, r *http.Request, rest string) {
+	parts := strings.Split(rest, "/")
+	switch {
+	case rest == "" && r.Method == "GET":
+		list := []map[string]interface{}{}
+		for _, rel := range g.releases {
+			list = append(list, rel.json())
+		}
+		writeJSON(w, http.StatusOK, list)
+	case rest == "" && r.Method == "POST":
+		var req struct {
+			TagName         string `json:"tag_name"`
+			TargetCommitish string `json:"target_commitish"`
+			Name            string `json:"name"`
+			Body            string `json:"body"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, rel := range g.releases {
+			if rel.TagName == req.TagName {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Validation Failed: tag_name already_exists"})
+				return
+			}
+		}
+		rel := &Release{ID: g.nextRelease, TagName: req.TagName, Target: req.TargetCommitish, Name: req.Name, Body: req.Body}
+		g.nextRelease++
+		g.releases = append(g.releases, rel)
+		if _, ok := g.commits[req.TargetCommitish]; ok {
+			g.refs["tags/"+req.TagName] = req.TargetCommitish
+		}
+		writeJSON(w, http.StatusCreated, rel.json())
+	case len(parts) == 2 && parts[0] == "tags" && r.Method == "GET":
+		for _, rel := range g.releases {
+			if rel.TagName == parts[1] {
+				writeJSON(w, http.StatusOK, rel.json())
+				return
+			}
+		}
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+	case len(parts) == 1 && r.Method == "DELETE":
+		rel := g.release(parts[0])
+		if rel == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		for i := range g.releases {
+			if g.releases[i] == rel {
+				g.releases = append(g.releases[:i], g.releases[i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] == "assets" && r.Method == "POST":
+		rel := g.release(parts[0])
+		if rel == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		id := rel.ID
+		name := r.URL.Query().Get("name")
+		for _, a := range rel.Assets {
+			if a.Name == name {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Validation Failed: name already_exists"})
+				return
+			}
+		}
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a := Asset{ID: 100*id + len(rel.Assets) + 1, Name: name, ContentType: r.Header.Get("Content-Type"), Content: content}
+		rel.Assets = append(rel.Assets, a)
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"id": a.ID, "name": a.Name, "size": len(content), "content_type": a.ContentType})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+	}
+}
@@ -0,0 +1,70 @@
+package fake
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReliefWeb serves the playlist files, one per category, with their
+// Last-Modified date but no ETag.
+type ReliefWeb struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	feeds    map[string]string
+	modified map[string]time.Time
+	// NotModified counts the requests answered 304 Not Modified.
+	NotModified int
+}
+
+// NewReliefWeb starts a fake serving feeds keyed by category, so
+// "/topic.json" returns feeds["topic"].
+func NewReliefWeb(feeds map[string]string) *ReliefWeb {
+	rw := &ReliefWeb{feeds: feeds, modified: map[string]time.Time{}}
+	for category := range feeds {
+		rw.touch(category)
+	}
+	rw.Server = httptest.NewServer(http.HandlerFunc(rw.serve))
+	return rw
+}
+
+// SetFeed replaces the feed of category.
+func (rw *ReliefWeb) SetFeed(category, feed string) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.feeds[category] = feed
+	rw.touch(category)
+}
+
+// touch moves the modification date of category forward, by at least a
+// second as HTTP dates have no finer resolution.
+func (rw *ReliefWeb) touch(category string) {
+	now := time.Now().UTC().Truncate(time.Second)
+	if next := rw.modified[category].Add(time.Second); now.Before(next) {
+		now = next
+	}
+	rw.modified[category] = now
+}
+
+func (rw *ReliefWeb) serve(w http.ResponseWriter, r *http.Request) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	category := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".json")
+	feed, ok := rw.feeds[category]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	modified := rw.modified[category]
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+		rw.NotModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(feed))
+}
@@ -0,0 +1,181 @@
+package fake
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// S3 serves path-style bucket and object requests, checking their AWS
+// Signature Version 4 like MinIO does.
+type S3 struct {
+	*httptest.Server
+	AccessKey, SecretKey, Region string
+
+	mu      sync.Mutex
+	buckets map[string]map[string]Object
+	// Requests counts the requests per method.
+	Requests map[string]int
+}
+
+// Object is a stored object.
+type Object struct {
+	Content     []byte
+	ContentType string
+}
+
+// NewS3 starts a fake holding empty buckets, accepting one key pair.
+func NewS3(accessKey, secretKey, region string, buckets ...string) *S3 {
+	s := &S3{AccessKey: accessKey, SecretKey: secretKey, Region: region,
+		buckets: map[string]map[string]Object{}, Requests: map[string]int{}}
+	for _, b := range buckets {
+		s.buckets[b] = map[string]Object{}
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Objects copies the objects of bucket by key.
+func (s *S3) Objects(bucket string) map[string]Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects := map[string]Object{}
+	for k, o := range s.buckets[bucket] {
+		objects[k] = o
+	}
+	return objects
+}
+
+// s3Error writes the XML error body of S3.
+func s3Error(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
+
+func (s *S3) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Requests[r.Method]++
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if code, message := s.verify(r, body); code != "" {
+		s3Error(w, http.StatusForbidden, code, message)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket, ok := s.buckets[parts[0]]
+	if !ok {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == "HEAD":
+	case len(parts) == 2 && r.Method == "PUT":
+		bucket[parts[1]] = Object{Content: body, ContentType: r.Header.Get("Content-Type")}
+	case len(parts) == 2 && r.Method == "GET":
+		o, ok := bucket[parts[1]]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("Content-Type", o.ContentType)
+		w.Write(o.Content)
+	case len(parts) == 2 && r.Method == "DELETE":
+		delete(bucket, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed")
+	}
+}
+
+// verify recomputes the signature of r, returning the error code when it
+// does not match.
+func (s *S3) verify(r *http.Request, body []byte) (string, string) {
+	var credential, signedHeaders, signature string
+	for _, field := range strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "Credential":
+			credential = kv[1]
+		case "SignedHeaders":
+			signedHeaders = kv[1]
+		case "Signature":
+			signature = kv[1]
+		}
+	}
+	scope := strings.SplitN(credential, "/", 2)
+	if len(scope) != 2 || scope[0] != s.AccessKey {
+		return "InvalidAccessKeyId", "The access key id does not exist in our records."
+	}
+	sum := sha256.Sum256(body)
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != hex.EncodeToString(sum[:]) {
+		return "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed."
+	}
+	var headers strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		fmt.Fprintf(&headers, "%s:%s\n", name, strings.Join(strings.Fields(value), " "))
+	}
+	var query []string
+	for k, values := range r.URL.Query() {
+		for _, v := range values {
+			query = append(query, url.QueryEscape(k)+"="+strings.Replace(url.QueryEscape(v), "+", "%20", -1))
+		}
+	}
+	sort.Strings(query)
+	canonical := strings.Join([]string{r.Method, awsEscape(r.URL.Path), strings.Join(query, "&"), headers.String(), signedHeaders, payloadHash}, "\n")
+	canonicalSum := sha256.Sum256([]byte(canonical))
+	amzDate := r.Header.Get("X-Amz-Date")
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope[1] + "\n" + hex.EncodeToString(canonicalSum[:])
+	parts := strings.Split(scope[1], "/")
+	if len(parts) != 4 || parts[1] != s.Region || len(amzDate) < 8 || parts[0] != amzDate[:8] {
+		return "AuthorizationHeaderMalformed", "The authorization header is malformed."
+	}
+	key := []byte("AWS4" + s.SecretKey)
+	for _, p := range parts {
+		key = sign(key, p)
+	}
+	if hex.EncodeToString(sign(key, toSign)) != signature {
+		return "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."
+	}
+	return "", ""
+}
+
+// awsEscape encodes path as AWS does for signing, keeping only the
+// unreserved characters and the slashes.
+func awsEscape(path string) string {
+	var b strings.Builder
+	for _, c := range []byte(path) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sign(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
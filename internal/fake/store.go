@@ -0,0 +1,92 @@
+package fake
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// store is the history of one branch for the fakes of hosts that commit
+// whole files rather than trees.
+type store struct {
+	branch  string
+	head    string
+	commits map[string]*storedCommit
+	blobs   map[string]string
+}
+
+type storedCommit struct {
+	Commit
+	files map[string]string // path -> content
+}
+
+func newStore(branch string, files map[string]string) *store {
+	s := &store{branch: branch, commits: map[string]*storedCommit{}, blobs: map[string]string{}}
+	s.commit("initial", files)
+	return s
+}
+
+// commit records files as the new head.
+func (s *store) commit(message string, files map[string]string) string {
+	var parents []string
+	if s.head != "" {
+		parents = []string{s.head}
+	}
+	for _, content := range files {
+		s.blobs[hash("blob", content)] = content
+	}
+	sha := hash("commit", fmt.Sprintf("%s\n%s\n%v\n%d", s.treeSHA(files), message, parents, len(s.commits)))
+	s.commits[sha] = &storedCommit{Commit: Commit{SHA: sha, Message: message, Tree: s.treeSHA(files), Parents: parents}, files: files}
+	s.head = sha
+	return sha
+}
+
+// treeSHA names the content of files, like the root tree of a commit.
+func (s *store) treeSHA(files map[string]string) string {
+	var paths []string
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var b strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s %s\n", p, hash("blob", files[p]))
+	}
+	return hash("tree", b.String())
+}
+
+// headFiles copies the files of the head commit.
+func (s *store) headFiles() map[string]string {
+	files := map[string]string{}
+	for p, content := range s.commits[s.head].files {
+		files[p] = content
+	}
+	return files
+}
+
+// storeEntry is a file or directory of a recursive tree listing.
+type storeEntry struct {
+	Path, Type, SHA string
+}
+
+// entries lists the files of commit sha and their directories, sorted by
+// path.
+func (s *store) entries(sha string) ([]storeEntry, bool) {
+	c, ok := s.commits[sha]
+	if !ok {
+		return nil, false
+	}
+	var entries []storeEntry
+	dirs := map[string]bool{}
+	for p, content := range c.files {
+		entries = append(entries, storeEntry{Path: p, Type: "blob", SHA: hash("blob", content)})
+		for i := strings.LastIndex(p, "/"); i > 0; i = strings.LastIndex(p[:i], "/") {
+			dirs[p[:i]] = true
+		}
+	}
+	for d := range dirs {
+		entries = append(entries, storeEntry{Path: d, Type: "tree", SHA: hash("tree", d)})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, true
+}
@@ -0,0 +1,451 @@
+// Package fake provides httptest servers standing in for the YouTube Data
+// API, the ReliefWeb playlist files, the GitHub, GitLab and Gitea
+// repository APIs and S3-compatible object storage.
+package fake
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Video is a playlist item served by the YouTube fake.
+type Video struct {
+	Id    string
+	Title string
+	// Thumbnail, when set, is served as the high thumbnail url.
+	Thumbnail string
+	// Captions are the caption tracks of the video.
+	Captions []Caption
+	// Private videos are listed as such and cannot be added to playlists.
+	Private bool
+}
+
+// Caption is a caption track, one without VTT belongs to a video the
+// channel does not own and cannot be downloaded.
+type Caption struct {
+	Id       string
+	Language string
+	// Kind is "standard" or "asr" for automatic speech recognition.
+	Kind string
+	VTT  string
+}
+
+// YouTube serves the playlistItems, videos, captions and playlists
+// endpoints.
+type YouTube struct {
+	*httptest.Server
+	// APIKey, when set, is required on every request without OAuth.
+	APIKey string
+	// OAuthToken, when set, is the bearer token accepted on requests
+	// creating playlists and inserting items, which all need one.
+	OAuthToken string
+	// PageSize, when set, caps maxResults to force pagination.
+	PageSize int
+	// RepeatToken makes every page hand back its own token.
+	RepeatToken bool
+	// QuotaExceeded fails every request as out of quota.
+	QuotaExceeded bool
+	// PlainErrors are the statuses answered in turn, with a body that is
+	// not JSON as a proxy would send, to the next playlist item insertions.
+	PlainErrors []int
+
+	mu        sync.Mutex
+	playlists map[string][]Video
+	// unlisted are the videos of deleted playlists, deleted the videos
+	// removed from YouTube and created the playlists inserted through the
+	// API.
+	unlisted map[string]Video
+	deleted  map[string]bool
+	created  []*Playlist
+	// Requests counts the requests per path.
+	Requests map[string]int
+}
+
+// Playlist is a playlist created through the API.
+type Playlist struct {
+	Id      string
+	Title   string
+	Privacy string
+}
+
+// NewYouTube starts a fake serving playlists keyed by playlist id.
+func NewYouTube(playlists map[string][]Video) *YouTube {
+	y := &YouTube{playlists: playlists, unlisted: map[string]Video{}, deleted: map[string]bool{}, Requests: map[string]int{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/playlists", y.insertPlaylist)
+	mux.HandleFunc("/playlistItems", y.playlistItems)
+	mux.HandleFunc("/videos", y.videos)
+	mux.HandleFunc("/captions", y.captions)
+	mux.HandleFunc("/captions/", y.caption)
+	y.Server = httptest.NewServer(y.count(mux))
+	return y
+}
+
+// SetPlaylist replaces the items of playlist id.
+func (y *YouTube) SetPlaylist(id string, videos []Video) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.playlists[id] = videos
+}
+
+// DeletePlaylist removes playlist id, its videos stay on YouTube.
+func (y *YouTube) DeletePlaylist(id string) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	for _, v := range y.playlists[id] {
+		y.unlisted[v.Id] = v
+	}
+	delete(y.playlists, id)
+}
+
+// DeleteVideo removes video id from YouTube, videos.list no longer finds
+// it and it cannot be inserted in a playlist.
+func (y *YouTube) DeleteVideo(id string) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.deleted[id] = true
+}
+
+// Created returns the playlists created through the API.
+func (y *YouTube) Created() []Playlist {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	var playlists []Playlist
+	for _, p := range y.created {
+		playlists = append(playlists, *p)
+	}
+	return playlists
+}
+
+// Items returns the videos of playlist id.
+func (y *YouTube) Items(id string) []Video {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	return append([]Video(nil), y.playlists[id]...)
+}
+
+func (y *YouTube) count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		y.mu.Lock()
+		y.Requests[r.URL.Path]++
+		y.mu.Unlock()
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			if y.OAuthToken != "" && auth != "Bearer "+y.OAuthToken {
+				writeError(w, http.StatusUnauthorized, "authError", "Invalid Credentials")
+				return
+			}
+		} else if y.APIKey != "" && r.URL.Query().Get("key") != y.APIKey {
+			writeError(w, http.StatusBadRequest, "keyInvalid", "API key not valid.")
+			return
+		}
+		if y.QuotaExceeded {
+			writeError(w, http.StatusForbidden, "quotaExceeded", "The request cannot be completed because you have exceeded your quota.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeCacheable writes v with an ETag, answering 304 Not Modified when
+// the request already holds it.
+func writeCacheable(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	etag := fmt.Sprintf("%q", fmt.Sprintf("%x", sha1.Sum(body)))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// writeError writes a Google API style error body.
+func writeError(w http.ResponseWriter, status int, reason, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": message,
+			"errors":  []map[string]string{{"reason": reason, "message": message}},
+		},
+	})
+}
+
+// authorized fails the requests needing OAuth sent without it, writes
+// and caption downloads.
+func authorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") == "" {
+		writeError(w, http.StatusUnauthorized, "required", "Login Required.")
+		return false
+	}
+	return true
+}
+
+// known returns video id when it is on YouTube.
+func (y *YouTube) known(id string) (Video, bool) {
+	if y.deleted[id] {
+		return Video{}, false
+	}
+	for _, videos := range y.playlists {
+		for _, v := range videos {
+			if v.Id == id {
+				return v, true
+			}
+		}
+	}
+	v, ok := y.unlisted[id]
+	return v, ok
+}
+
+// insertPlaylist creates an empty playlist.
+func (y *YouTube) insertPlaylist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "methodNotAllowed", "Only playlist creation is served.")
+		return
+	}
+	if !authorized(w, r) {
+		return
+	}
+	var body struct {
+		Snippet struct {
+			Title string `json:"title"`
+		} `json:"snippet"`
+		Status struct {
+			PrivacyStatus string `json:"privacyStatus"`
+		} `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Snippet.Title == "" {
+		writeError(w, http.StatusBadRequest, "playlistTitleRequired", "The request must specify a playlist title.")
+		return
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	p := &Playlist{Id: fmt.Sprintf("PLcreated%d", len(y.created)+1), Title: body.Snippet.Title, Privacy: body.Status.PrivacyStatus}
+	if p.Privacy == "" {
+		p.Privacy = "public"
+	}
+	y.created = append(y.created, p)
+	y.playlists[p.Id] = []Video{}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"kind":    "youtube#playlist",
+		"id":      p.Id,
+		"snippet": map[string]string{"title": p.Title},
+		"status":  map[string]string{"privacyStatus": p.Privacy},
+	})
+}
+
+// playlistItems pages through a playlist, page tokens are item offsets.
+func (y *YouTube) playlistItems(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		y.insertPlaylistItem(w, r)
+		return
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	q := r.URL.Query()
+	videos, ok := y.playlists[q.Get("playlistId")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "playlistNotFound", "The playlist identified with the request's playlistId parameter cannot be found.")
+		return
+	}
+	size, err := strconv.Atoi(q.Get("maxResults"))
+	if err != nil || size <= 0 {
+		size = 5
+	}
+	if y.PageSize > 0 && size > y.PageSize {
+		size = y.PageSize
+	}
+	start := 0
+	if token := q.Get("pageToken"); token != "" {
+		if start, err = strconv.Atoi(token); err != nil || start < 0 || start > len(videos) {
+			writeError(w, http.StatusBadRequest, "invalidPageToken", "The request specifies an invalid page token.")
+			return
+		}
+	}
+	end := start + size
+	if end > len(videos) {
+		end = len(videos)
+	}
+	items := []map[string]interface{}{}
+	for i, v := range videos[start:end] {
+		snippet := map[string]interface{}{
+			"title":      v.Title,
+			"position":   start + i,
+			"resourceId": map[string]string{"videoId": v.Id},
+		}
+		if v.Thumbnail != "" {
+			snippet["thumbnails"] = map[string]interface{}{
+				"high": map[string]interface{}{"url": v.Thumbnail, "width": 480, "height": 360},
+			}
+		}
+		items = append(items, map[string]interface{}{"snippet": snippet})
+	}
+	result := map[string]interface{}{
+		"items":    items,
+		"pageInfo": map[string]int{"totalResults": len(videos), "resultsPerPage": size},
+	}
+	if end < len(videos) {
+		result["nextPageToken"] = strconv.Itoa(end)
+		if y.RepeatToken {
+			result["nextPageToken"] = strconv.Itoa(start)
+		}
+	}
+	writeCacheable(w, r, result)
+}
+
+// insertPlaylistItem adds a video to a playlist at the requested
+// position, at its end when none is given.
+func (y *YouTube) insertPlaylistItem(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+	var body struct {
+		Snippet struct {
+			PlaylistId string `json:"playlistId"`
+			Position   *int   `json:"position"`
+			ResourceId struct {
+				Kind    string `json:"kind"`
+				VideoId string `json:"videoId"`
+			} `json:"resourceId"`
+		} `json:"snippet"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", "Parse Error")
+		return
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if len(y.PlainErrors) > 0 {
+		status := y.PlainErrors[0]
+		y.PlainErrors = y.PlainErrors[1:]
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	s := body.Snippet
+	videos, ok := y.playlists[s.PlaylistId]
+	if !ok {
+		writeError(w, http.StatusNotFound, "playlistNotFound", "Playlist not found.")
+		return
+	}
+	if s.ResourceId.Kind != "youtube#video" {
+		writeError(w, http.StatusBadRequest, "invalidResourceId", "The resource id is not a video.")
+		return
+	}
+	v, ok := y.known(s.ResourceId.VideoId)
+	if !ok {
+		writeError(w, http.StatusNotFound, "videoNotFound", "Video not found.")
+		return
+	}
+	if v.Private {
+		writeError(w, http.StatusForbidden, "forbidden", "The video cannot be added to the playlist.")
+		return
+	}
+	position := len(videos)
+	if s.Position != nil {
+		if *s.Position < 0 || *s.Position > len(videos) {
+			writeError(w, http.StatusBadRequest, "invalidPlaylistItemPosition", "Request contains an invalid value for the playlist item position.")
+			return
+		}
+		position = *s.Position
+	}
+	videos = append(videos[:position], append([]Video{v}, videos[position:]...)...)
+	y.playlists[s.PlaylistId] = videos
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"kind": "youtube#playlistItem",
+		"snippet": map[string]interface{}{
+			"playlistId": s.PlaylistId,
+			"title":      v.Title,
+			"position":   position,
+			"resourceId": map[string]string{"kind": "youtube#video", "videoId": v.Id},
+		},
+	})
+}
+
+// videos lists the requested ids found in any playlist and not deleted.
+func (y *YouTube) videos(w http.ResponseWriter, r *http.Request) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	items := []map[string]interface{}{}
+	for _, id := range strings.Split(r.URL.Query().Get("id"), ",") {
+		if v, ok := y.known(id); ok {
+			privacy := "public"
+			if v.Private {
+				privacy = "private"
+			}
+			items = append(items, map[string]interface{}{
+				"id":      v.Id,
+				"snippet": map[string]string{"title": v.Title},
+				"status":  map[string]string{"privacyStatus": privacy},
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":    items,
+		"pageInfo": map[string]int{"totalResults": len(items), "resultsPerPage": len(items)},
+	})
+}
+
+// captions lists the caption tracks of a video.
+func (y *YouTube) captions(w http.ResponseWriter, r *http.Request) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	id := r.URL.Query().Get("videoId")
+	for _, videos := range y.playlists {
+		for _, v := range videos {
+			if v.Id != id {
+				continue
+			}
+			items := []map[string]interface{}{}
+			for _, c := range v.Captions {
+				items = append(items, map[string]interface{}{
+					"id": c.Id,
+					"snippet": map[string]string{
+						"videoId":   v.Id,
+						"language":  c.Language,
+						"trackKind": c.Kind,
+					},
+				})
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "videoNotFound", "The video identified by the videoId parameter could not be found.")
+}
+
+// caption downloads a track, the VTT is served whatever tfmt asks for.
+func (y *YouTube) caption(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	id := strings.TrimPrefix(r.URL.Path, "/captions/")
+	for _, videos := range y.playlists {
+		for _, v := range videos {
+			for _, c := range v.Captions {
+				if c.Id != id {
+					continue
+				}
+				if c.VTT == "" {
+					writeError(w, http.StatusForbidden, "forbidden", "The permissions associated with the request are not sufficient to download the caption track.")
+					return
+				}
+				w.Header().Set("Content-Type", "text/vtt")
+				w.Write([]byte(c.VTT))
+				return
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, "captionNotFound", "The caption track could not be found.")
+}
@@ -1,315 +1,529 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"github.com/google/go-github/github"
-	"golang.org/x/oauth2"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rwapps/video_gists/backup"
+	"golang.org/x/oauth2"
 )
 
-// Config contains the site configuration.
-type Config struct {
-	Categories []string `json:"Categories"`
-}
+const usage = `usage: video_gists [command] [flags]
 
-// Ah: https://godoc.org/github.com/google/go-github/github
-// Github API structs.
-type Url struct {
-	Url string `json:"url"`
-}
+commands:
+  run               back up once and exit (the default)
+  serve             back up on the schedules of the configuration file
+  preflight         check the credentials and feeds a run needs
+  archive           export the backup tree to a tar.gz or zip archive
+  export            write the backup files as of a date or commit to a directory
+  history           list the commits that changed a playlist
+  diff              compare the backups of two dates or commits
+  rollback          commit the files of an earlier backup on top of the branch
+  restore-feeds     write the archived ReliefWeb playlist feeds back to files
+  restore-playlist  recreate a backed up playlist on YouTube
+`
 
-type SHA struct {
-	SHA string `json:"sha"`
+func main() {
+	command, args := "run", os.Args[1:]
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "run":
+		runOnce(args)
+	case "serve":
+		serve(args)
+	case "preflight":
+		preflight(args)
+	case "archive":
+		archive(args)
+	case "export":
+		export(args)
+	case "history":
+		history(args)
+	case "diff":
+		diff(args)
+	case "rollback":
+		rollback(args)
+	case "restore-feeds":
+		restoreFeeds(args)
+	case "restore-playlist":
+		restorePlaylist(args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
 }
 
-type Tree struct {
-	BaseTree string      `json:"base_tree,omitempty"`
-	SHA      string      `json:"sha,omitempty"`
-	Entries  []TreeEntry `json:"tree,omitempty"`
+// tokenVariables name the variable holding the token of each backend, the
+// local backend needs none.
+var tokenVariables = map[string]string{
+	"":       "GITHUBTOKEN",
+	"github": "GITHUBTOKEN",
+	"gitlab": "GITLABTOKEN",
+	"gitea":  "GITEATOKEN",
 }
 
-type TreeEntry struct {
-	SHA     string `json:"sha,omitempty"`
-	Path    string `json:"path,omitempty"`
-	Mode    string `json:"mode,omitempty"`
-	Type    string `json:"type,omitempty"`
-	Size    string `json:"size,omitempty"`
-	Content string `json:"content,omitempty"`
+// loadConfig reads the configuration file or exits.
+func loadConfig(path string) backup.Config {
+	config, err := backup.LoadConfig(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return config
 }
 
-type GitObject struct {
-	Url string `json:"url"`
-	SHA string `json:"sha"`
+// newRepoClient returns a client authenticated with the token of the
+// backend of config.
+func newRepoClient(config backup.Config) *http.Client {
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: os.Getenv(tokenVariables[config.Backend])},
+	)
+	return oauth2.NewClient(oauth2.NoContext, ts)
 }
 
-type GithubRefResult struct {
-	Object GitObject `json:"object"`
+// youtubeOAuth authorizes requests with the refresh token of a Google
+// OAuth client allowed to manage the YouTube channel, which creating
+// playlists and downloading captions need.
+var youtubeOAuth = oauth2.Config{
+	Endpoint: oauth2.Endpoint{
+		AuthURL:  "https://accounts.google.com/o/oauth2/auth",
+		TokenURL: "https://oauth2.googleapis.com/token",
+	},
+	Scopes: []string{"https://www.googleapis.com/auth/youtube.force-ssl"},
 }
 
-// Youtube
-type YoutubeResult struct {
-	NextPageToken string `json:"nextPageToken"`
-	Items         []Item `json:"items"`
+// newYoutubeOAuthClient returns nil without YOUTUBEREFRESHTOKEN.
+func newYoutubeOAuthClient() *http.Client {
+	token := os.Getenv("YOUTUBEREFRESHTOKEN")
+	if token == "" {
+		return nil
+	}
+	oauth := youtubeOAuth
+	oauth.ClientID = os.Getenv("YOUTUBECLIENTID")
+	oauth.ClientSecret = os.Getenv("YOUTUBECLIENTSECRET")
+	return oauth.Client(oauth2.NoContext, &oauth2.Token{RefreshToken: token})
 }
 
-type Item struct {
-	Snippet Snippet `json:"snippet"`
+// newApp builds the App around the clients.
+func newApp(config backup.Config, httpClient, repoClient *http.Client) *backup.App {
+	app, err := backup.NewApp(config, httpClient, repoClient)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.YoutubeAPIKey = os.Getenv("YOUTUBEAPIKEY")
+	app.S3AccessKey = os.Getenv("S3ACCESSKEY")
+	app.S3SecretKey = os.Getenv("S3SECRETKEY")
+	app.YoutubeOAuthClient = newYoutubeOAuthClient()
+	return app
 }
 
-type Snippet struct {
-	Title      string     `json:"title"`
-	Position   int        `json:"position"`
-	ResourceId ResourceId `json:"resourceId"`
+// signalContext is cancelled on SIGTERM or SIGINT.
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		s := <-signals
+		log.Printf("received %s", s)
+		cancel()
+	}()
+	return ctx
 }
 
-type ResourceId struct {
-	VideoId string `json:"videoId"`
-}
+func runOnce(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := fs.String("config", "./config/config.json", "path to the configuration file")
+	categories := fs.String("category", "", "comma separated categories to back up (default all)")
+	playlists := fs.String("playlist", "", "comma separated playlist ids or titles to back up (default all)")
+	record := fs.String("record", "", "record every HTTP exchange of the run to this cassette file")
+	replay := fs.String("replay", "", "replay the run from this cassette file instead of the network")
+	metricsFile := fs.String("metrics-file", "", "write the run metrics to this file for the textfile collector")
+	fs.Parse(args)
 
-type Video struct {
-	Title    string `json:"title"`
-	Position int    `json:"position"`
-	Id       string `json:"id"`
-}
+	config := loadConfig(*configPath)
+	if (*record != "" || *replay != "") && config.CacheDir != "" {
+		// A cassette recorded through the cache holds bodiless 304s that
+		// only the same cache can replay.
+		log.Printf("ignoring CacheDir while recording or replaying")
+		config.CacheDir = ""
+	}
+	httpClient := &http.Client{}
+	repoClient := newRepoClient(config)
+	var cassette *backup.Cassette
+	var err error
+	switch {
+	case *record != "" && *replay != "":
+		log.Fatal("-record and -replay are exclusive")
+	case *record != "":
+		cassette = &backup.Cassette{}
+		httpClient.Transport = cassette.Record(nil)
+		repoClient.Transport = cassette.Record(repoClient.Transport)
+	case *replay != "":
+		cassette, err = backup.LoadCassette(*replay)
+		if err != nil {
+			log.Fatal(err)
+		}
+		httpClient.Transport = cassette.Replay()
+		repoClient = httpClient
+	}
+
+	app := newApp(config, httpClient, repoClient)
+	app.Selection.Categories = backup.ParseList(*categories)
+	app.Selection.Playlists = backup.ParseList(*playlists)
+	switch {
+	case *record != "" && app.YoutubeOAuthClient != nil:
+		cassette.OAuth = true
+		app.YoutubeOAuthClient = &http.Client{Transport: cassette.Record(app.YoutubeOAuthClient.Transport)}
+	case *replay != "":
+		// The OAuth requests are replayed as the recording made them,
+		// whatever the environment holds.
+		app.YoutubeOAuthClient = nil
+		if cassette.OAuth {
+			app.YoutubeOAuthClient = httpClient
+		}
+		// The recorded run already notified.
+		app.NotifyClient = nil
+		app.SetClock(func() time.Time { return cassette.Time })
+	}
 
-// RW
-type Playlist struct {
-	Title      string `json:"title"`
-	Id         string `json:"id"`
-	DefaultImg string `json:"defaultImg"`
+	err = app.Run(signalContext())
+	if *record != "" {
+		cassette.Time = app.LastRun.Start
+		if err := cassette.Save(*record); err != nil {
+			log.Printf("failed to save cassette: %s", err)
+		}
+	}
+	if *metricsFile != "" {
+		if err := app.Metrics.WriteFile(*metricsFile); err != nil {
+			log.Printf("failed to write metrics: %s", err)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
-type OrgPlaylist struct {
-	Title      string `json:"name"`
-	Id         string `json:"playlist_id"`
-	DefaultImg string `json:"thumbnail_url"`
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := fs.String("config", "./config/config.json", "path to the configuration file")
+	addr := fs.String("addr", defaultAddr(), "address of the metrics and health endpoints")
+	fs.Parse(args)
+
+	config := loadConfig(*configPath)
+	app := newApp(config, nil, newRepoClient(config))
+	daemon, err := backup.NewDaemon(app)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", app.Metrics)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}` + "\n"))
+	})
+	mux.Handle("/readyz", &backup.Readiness{App: app, TTL: 5 * time.Minute})
+	server := &http.Server{Addr: *addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	err = daemon.Serve(signalContext())
+	server.Shutdown(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
-var config Config
-var videos []Video
-var videoList []Item
-var commitSHA string
-var treeSHA string
-var client github.Client
-var trees Tree
-
-// TODO: the handling here should be elsewhere
-// make this do one thing - and bundle the trees to streamline.
-func addToTree(path, content string) {
-	tree := TreeEntry{}
-	tree.Type = "blob"
-	tree.Mode = "100644"
-	tree.Content = content
-	tree.Path = path
-	trees.Entries = append(trees.Entries, tree)
+func preflight(args []string) {
+	fs := flag.NewFlagSet("preflight", flag.ExitOnError)
+	configPath := fs.String("config", "./config/config.json", "path to the configuration file")
+	jsonOutput := fs.Bool("json", false, "print the results as JSON")
+	fs.Parse(args)
+
+	config := loadConfig(*configPath)
+	app := newApp(config, nil, newRepoClient(config))
+	ctx, cancel := context.WithTimeout(signalContext(), time.Minute)
+	defer cancel()
+	checks := app.Preflight(ctx)
+	failed := false
+	for _, c := range checks {
+		failed = failed || !c.OK
+	}
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(checks)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, c := range checks {
+			status := "ok"
+			if !c.OK {
+				status = "FAIL"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Name, status, c.Detail)
+		}
+		w.Flush()
+	}
+	if failed {
+		os.Exit(1)
+	}
 }
 
-func commitTrees(trees Tree) {
-	treeSHA = createTree(trees)
-	// New commit grab the sha
-	commitSHA = createCommit(treeSHA)
-	// Update refs
-	updateRefs(commitSHA)
+// defaultAddr listens on $PORT when the platform sets it.
+func defaultAddr() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return ":8080"
 }
 
-func createTree(trees Tree) string {
-	treeJson, err := json.Marshal(trees)
+func archive(args []string) {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	configPath := fs.String("config", "./config/config.json", "path to the configuration file")
+	dir := fs.String("dir", ".", "directory receiving the archive")
+	format := fs.String("format", "tar.gz", "archive format, tar.gz or zip")
+	release := fs.Bool("release", false, "attach the archive to the GitHub release of the day")
+	fs.Parse(args)
+
+	config := loadConfig(*configPath)
+	app := newApp(config, nil, newRepoClient(config))
+	result, err := app.ExportArchive(signalContext(), *dir, *format, *release)
 	if err != nil {
-		fmt.Printf("failed to marshal tree %s\n", err)
+		log.Fatal(err)
 	}
-	body := githubRequest("POST", "https://api.github.com/repos/rwapps/video_backups/git/trees", "201 Created", treeJson)
-	treeResult := SHA{}
-	if err := json.Unmarshal(body, &treeResult); err != nil {
-		fmt.Printf("failed to decode resp.Body %s\n", err)
+	fmt.Println(result.Path)
+	if result.Release != "" {
+		fmt.Printf("attached to release %s\n", result.Release)
 	}
-	return treeResult.SHA
 }
 
-func createCommit(treeSHA string) string {
-	payload := fmt.Sprintf("{ \"message\": \"updating playlists\", \"tree\": %q, \"parents\": [ %q ] }", treeSHA, commitSHA)
-	body := githubRequest("POST", "https://api.github.com/repos/rwapps/video_backups/git/commits", "201 Created", []byte(payload))
-	commitSHAs := SHA{}
-	if err := json.Unmarshal(body, &commitSHAs); err != nil {
-		fmt.Printf("failed to decode resp.Body %s\n", err)
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := fs.String("config", "./config/config.json", "path to the configuration file")
+	at := fs.String("at", "", "date (2006-01-02 or RFC 3339) or commit of the backup to export")
+	dir := fs.String("dir", ".", "directory receiving the files")
+	categories := fs.String("category", "", "comma separated categories to export (default all files)")
+	playlists := fs.String("playlist", "", "comma separated playlist titles to export (default all)")
+	fs.Parse(args)
+	if *at == "" {
+		log.Fatal("-at is required")
 	}
-	return commitSHAs.SHA
-}
 
-func updateRefs(commitSHA string) {
-	payload := fmt.Sprintf("{ \"sha\": %q }", commitSHA)
-	body := githubRequest("PATCH", "https://api.github.com/repos/rwapps/video_backups/git/refs/heads/master", "200 OK", []byte(payload))
-	updateResult := GithubRefResult{}
-	if err := json.Unmarshal(body, &updateResult); err != nil {
-		fmt.Printf("failed to decode resp.Body %s\n", err)
+	config := loadConfig(*configPath)
+	app := newApp(config, nil, newRepoClient(config))
+	app.Selection.Categories = backup.ParseList(*categories)
+	app.Selection.Playlists = backup.ParseList(*playlists)
+	result, err := app.ExportAt(signalContext(), *at, *dir)
+	if err != nil {
+		log.Fatal(err)
 	}
+	fmt.Printf("exported %d files of %s (%s) to %s\n", result.Files, result.Commit, result.Date.Format(time.RFC3339), *dir)
 }
 
-func backupPlaylists(category string, playlists []Playlist) {
-	for _, p := range playlists {
-		videoList = videoList[:0]
-		videos = videos[:0]
-		videos = getVideos(p.Id, "")
-		content, err := json.Marshal(videos)
-		if err != nil {
-			fmt.Printf("failed to marshal videos %s\n", err)
-		}
-		output := fmt.Sprintf("{ \"defaultImg\": %q, \"videos\": %s }", p.DefaultImg, content)
-		// Sanitize filenames - stumbled on "Refugees/Migrants Emergency - Europe"
-		if strings.Contains(p.Title, "/") {
-			p.Title = strings.Replace(p.Title, "/", "-", -1)
-		}
-		path := fmt.Sprintf("%s/%s.json", category, p.Title)
-		addToTree(path, output)
+func history(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	configPath := fs.String("config", "./config/config.json", "path to the configuration file")
+	jsonOutput := fs.Bool("json", false, "print the history as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: video_gists history [flags] <category> <playlist title or id>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
 	}
-}
 
-func getVideos(playlistId, nextPageToken string) []Video {
-	u, err := url.Parse("https://www.googleapis.com/youtube/v3/playlistItems")
+	config := loadConfig(*configPath)
+	app := newApp(config, nil, newRepoClient(config))
+	h, err := app.History(signalContext(), fs.Arg(0), fs.Arg(1))
 	if err != nil {
-		fmt.Println("couldn't parse api url")
-	}
-	q := u.Query()
-	q.Set("part", "snippet")
-	q.Set("maxResults", "50")
-	q.Set("fields", "nextPageToken,items/snippet(position,title,resourceId/videoId)")
-	q.Set("playlistId", playlistId)
-	q.Set("key", os.Getenv("YOUTUBEAPIKEY"))
-	q.Set("pageToken", nextPageToken)
-	u.RawQuery = q.Encode()
-	resp, err := http.Get(u.String())
-	if err != nil {
-		fmt.Printf("failed to get from gapis %s\n", err)
-	}
-	result := YoutubeResult{}
-	defer resp.Body.Close()
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		fmt.Printf("failed to decode resp.Body %s\n", err)
-	}
-	videoList = append(videoList, result.Items...)
-	if result.NextPageToken != "" {
-		nextPageToken = result.NextPageToken
-		result.NextPageToken = ""
-		getVideos(playlistId, nextPageToken)
-	} else {
-		for _, vid := range videoList {
-			v := Video{}
-			v.Title = vid.Snippet.Title
-			v.Position = vid.Snippet.Position
-			v.Id = vid.Snippet.ResourceId.VideoId
-			videos = append(videos, v)
+		log.Fatal(err)
+	}
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(h)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DATE\tCOMMIT\tADDED\tREMOVED")
+	for _, c := range h.Commits {
+		fmt.Fprintf(w, "%s\t%.7s\t%d\t%d\n", c.Date.Format(time.RFC3339), c.Commit, len(c.Added), len(c.Removed))
+		for _, v := range c.Added {
+			fmt.Fprintf(w, "\t\t+ %s\t%s\n", v.Id, v.Title)
+		}
+		for _, v := range c.Removed {
+			fmt.Fprintf(w, "\t\t- %s\t%s\n", v.Id, v.Title)
+		}
+		if c.Unchanged {
+			fmt.Fprintln(w, "\t\tsame videos, only titles, positions or dates changed")
 		}
 	}
-	return videos
+	w.Flush()
 }
 
-func githubRequest(verb, u, status string, input []byte) []byte {
-	req, err := http.NewRequest(verb, u, bytes.NewBuffer(input))
-	if err != nil {
-		log.Fatal("Cannot make request for trees.")
+func diff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	configPath := fs.String("config", "./config/config.json", "path to the configuration file")
+	format := fs.String("format", "text", "output format: text, json or markdown")
+	categories := fs.String("category", "", "comma separated categories to compare (default all)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: video_gists diff [flags] <from> <to>")
+		fmt.Fprintln(os.Stderr, "from and to are commits or dates (2006-01-02 or RFC 3339)")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *format != "text" && *format != "json" && *format != "markdown" {
+		log.Fatalf("unknown format %q", *format)
 	}
-	req.Header.Set("Authorization", "token "+os.Getenv("GITHUBTOKEN"))
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	config := loadConfig(*configPath)
+	app := newApp(config, nil, newRepoClient(config))
+	app.Selection.Categories = backup.ParseList(*categories)
+	d, err := app.Diff(signalContext(), fs.Arg(0), fs.Arg(1))
 	if err != nil {
-		log.Fatal("Cannot get trees from github.")
+		log.Fatal(err)
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println("failed to readall body")
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(d)
+	case "markdown":
+		d.WriteMarkdown(os.Stdout)
+	default:
+		d.WriteText(os.Stdout)
 	}
+}
 
-	if resp.Status != status {
-		panic(fmt.Sprintf("Failed status test, error body:\n %s\n", body))
+func rollback(args []string) {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	configPath := fs.String("config", "./config/config.json", "path to the configuration file")
+	to := fs.String("to", "", "date (2006-01-02 or RFC 3339) or commit of the backup to restore")
+	categories := fs.String("category", "", "comma separated categories to roll back (default all files)")
+	reason := fs.String("reason", "", "explanation added to the commit message")
+	fs.Parse(args)
+	if *to == "" {
+		log.Fatal("-to is required")
 	}
-	return body
-}
 
-func getRwPlaylists(category string) []byte {
-	u := fmt.Sprintf("http://reliefweb.int/sites/reliefweb.int/files/playlists/%s.json", category)
-	resp, err := http.Get(u)
+	config := loadConfig(*configPath)
+	app := newApp(config, nil, newRepoClient(config))
+	app.Selection.Categories = backup.ParseList(*categories)
+	result, err := app.Rollback(signalContext(), *to, *reason)
 	if err != nil {
-		fmt.Println("failed to get url")
+		log.Fatal(err)
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	fmt.Printf("committed %s restoring %d files of %s (%s)\n", result.Commit, result.Changed, result.Target, result.Date.Format(time.RFC3339))
+}
+
+func restoreFeeds(args []string) {
+	fs := flag.NewFlagSet("restore-feeds", flag.ExitOnError)
+	configPath := fs.String("config", "./config/config.json", "path to the configuration file")
+	at := fs.String("at", "", "date (2006-01-02 or RFC 3339) or commit of the backup (default the latest)")
+	dir := fs.String("dir", ".", "directory receiving the <category>.json feeds")
+	categories := fs.String("category", "", "comma separated categories to restore (default all)")
+	fs.Parse(args)
+
+	config := loadConfig(*configPath)
+	app := newApp(config, nil, newRepoClient(config))
+	app.Selection.Categories = backup.ParseList(*categories)
+	feeds, err := app.RestoreFeeds(signalContext(), *at, *dir)
 	if err != nil {
-		fmt.Println("failed to readall body")
+		log.Fatal(err)
+	}
+	for _, f := range feeds {
+		fmt.Printf("%s: %d playlists written to %s\n", f.Category, f.Playlists, f.Path)
 	}
-	return body
 }
 
-func preparePlaylists(category string, rwPlaylists []byte) []Playlist {
-	var playlists []Playlist
-	if category == "organization" {
-		var orgPlaylists map[string]OrgPlaylist
-		err := json.Unmarshal(rwPlaylists, &orgPlaylists)
+func restorePlaylist(args []string) {
+	fs := flag.NewFlagSet("restore-playlist", flag.ExitOnError)
+	configPath := fs.String("config", "./config/config.json", "path to the configuration file")
+	at := fs.String("at", "", "date (2006-01-02 or RFC 3339) or commit of the backup (default the latest)")
+	file := fs.String("file", "", "restore this playlist file instead of one of the backup")
+	title := fs.String("title", "", "title of the new playlist (default the archived one)")
+	privacy := fs.String("privacy", "private", "privacy status of the new playlist: private, unlisted or public")
+	dryRun := fs.Bool("dry-run", false, "only report which videos can be restored")
+	jsonOutput := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: video_gists restore-playlist [flags] <category> <playlist title or id>")
+		fmt.Fprintln(os.Stderr, "       video_gists restore-playlist [flags] -file <playlist file>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (*file == "" && fs.NArg() != 2) || (*file != "" && fs.NArg() != 0) {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	config := loadConfig(*configPath)
+	app := newApp(config, nil, newRepoClient(config))
+	ctx := signalContext()
+	var name string
+	var f *backup.PlaylistFile
+	if *file != "" {
+		content, err := ioutil.ReadFile(*file)
 		if err != nil {
-			fmt.Printf("failed to unmarshal playlists %v\n", rwPlaylists)
+			log.Fatal(err)
 		}
-		for _, p := range orgPlaylists {
-			playlist := Playlist{}
-			playlist.Title = p.Title
-			playlist.Id = p.Id
-			playlist.DefaultImg = p.DefaultImg
-			playlists = append(playlists, playlist)
+		f = &backup.PlaylistFile{}
+		if err := json.Unmarshal(content, f); err != nil {
+			log.Fatalf("invalid playlist file %s: %s", *file, err)
 		}
+		name = strings.TrimSuffix(filepath.Base(*file), ".json")
 	} else {
-		err := json.Unmarshal(rwPlaylists, &playlists)
-		if err != nil {
-			fmt.Printf("failed to unmarshal playlists %v\n", rwPlaylists)
+		var err error
+		if name, f, err = app.ArchivedPlaylist(ctx, fs.Arg(0), fs.Arg(1), *at); err != nil {
+			log.Fatal(err)
 		}
 	}
-	return playlists
-}
-
-// init read the configuration file and initialize github SHAs
-func init() {
-	ctx := context.TODO()
-	data, err := ioutil.ReadFile("./config/config.json")
-	if err != nil {
-		log.Fatal("Cannot read configuration file.")
-	}
-	err = json.Unmarshal(data, &config)
-	if err != nil {
-		log.Fatal("Invalid configuration file.")
-	}
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: os.Getenv("GITHUBTOKEN")},
-	)
-	tc := oauth2.NewClient(oauth2.NoContext, ts)
-	client := github.NewClient(tc)
-	ref, _, err := client.Git.GetRef(ctx, "rwapps", "video_backups", "heads/master")
-	if err != nil {
-		log.Fatal("git getref error")
+	r, err := app.RestorePlaylist(ctx, name, f, backup.RestoreOptions{Title: *title, Privacy: *privacy, DryRun: *dryRun})
+	if r != nil {
+		if *jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(r)
+		} else {
+			writeRestore(r)
+		}
 	}
-	commitSHA = *ref.Object.SHA
-	repoCommit, _, err := client.Repositories.GetCommit(ctx, "rwapps", "video_backups", commitSHA)
 	if err != nil {
-		log.Fatal("git getcommit error")
+		log.Fatal(err)
 	}
-	treeSHA = *repoCommit.Commit.Tree.SHA
-	trees.BaseTree = treeSHA
 }
 
-func main() {
-	for _, category := range config.Categories {
-		fmt.Printf("category %v\n", category)
-		rwPlaylists := getRwPlaylists(category)
-		path := fmt.Sprintf("%s/playlist.json", category)
-		addToTree(path, string(rwPlaylists))
-
-		playlists := preparePlaylists(category, rwPlaylists)
-		backupPlaylists(category, playlists)
+// writeRestore prints a playlist restore for a terminal.
+func writeRestore(r *backup.PlaylistRestore) {
+	if r.DryRun {
+		fmt.Printf("dry run: %d of %d videos of %s can be restored\n", len(r.Restored), len(r.Restored)+len(r.Unrestorable), r.Title)
+	} else {
+		fmt.Printf("%s restored as %s playlist %s with %d videos\n", r.Title, r.Privacy, r.Playlist, len(r.Restored))
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, v := range r.Unrestorable {
+		fmt.Fprintf(w, "  ! %d\t%s\t%s\t%s\n", v.Position, v.Id, v.Title, v.Reason)
 	}
-	commitTrees(trees)
+	w.Flush()
 }